@@ -0,0 +1,96 @@
+package sds011
+
+import (
+	"fmt"
+	"sort"
+)
+
+// SenseN queries the sensor until it has n valid measurements and returns them in the order they were taken. The
+// device should be in ModeQuery. Queries that time out and measurements rejected by options such as
+// WithRangeCheck are skipped, but if more than n are skipped then SenseN gives up and returns the measurements
+// taken so far along with the last error. Any other error is returned immediately, also with the measurements
+// taken so far.
+func (d *Dev) SenseN(n int) ([]Measurement, error) {
+	if n < 1 {
+		return nil, fmt.Errorf("sds011: number of samples must be positive, got %v", n)
+	}
+
+	ms := make([]Measurement, 0, n)
+	missed := 0
+	for len(ms) < n {
+		m, err := d.Sense()
+		if err == ErrTimeout || rejected(err) {
+			missed++
+			if missed > n {
+				return ms, err
+			}
+			continue
+		} else if err != nil {
+			return ms, err
+		}
+
+		ms = append(ms, m)
+	}
+	return ms, nil
+}
+
+// SenseAverage queries the sensor n times and returns the mean PM2.5 and PM10. The device should be in
+// ModeQuery. Each query takes roughly one read cycle, so SenseAverage blocks for about n of them, plus up to
+// the read timeout for each query the sensor doesn't answer. It returns an error only if no query succeeds.
+// The returned measurement has the time and device ID of the last sample.
+func (d *Dev) SenseAverage(n int) (Measurement, error) {
+	ms, err := d.SenseN(n)
+	if len(ms) == 0 {
+		return Measurement{}, err
+	}
+
+	var pm25, pm10 float64
+	for _, m := range ms {
+		pm25 += float64(m.PM25)
+		pm10 += float64(m.PM10)
+	}
+
+	last := ms[len(ms)-1]
+	return Measurement{
+		PM25:     float32(pm25 / float64(len(ms))),
+		PM10:     float32(pm10 / float64(len(ms))),
+		DeviceID: last.DeviceID,
+		Time:     last.Time,
+	}, nil
+}
+
+// SenseMedian queries the sensor n times and returns the median PM2.5 and PM10, each computed independently.
+// For even n the two central values are averaged. The median is more robust than SenseAverage to the
+// occasional spurious reading. Timing and error behavior are the same as SenseAverage.
+func (d *Dev) SenseMedian(n int) (Measurement, error) {
+	ms, err := d.SenseN(n)
+	if len(ms) == 0 {
+		return Measurement{}, err
+	}
+
+	pm25 := make([]float64, len(ms))
+	pm10 := make([]float64, len(ms))
+	for i, m := range ms {
+		pm25[i] = float64(m.PM25)
+		pm10[i] = float64(m.PM10)
+	}
+
+	last := ms[len(ms)-1]
+	return Measurement{
+		PM25:     float32(median(pm25)),
+		PM10:     float32(median(pm10)),
+		DeviceID: last.DeviceID,
+		Time:     last.Time,
+	}, nil
+}
+
+// median returns the median of s, sorting s in place.
+func median(s []float64) float64 {
+	sort.Float64s(s)
+
+	mid := len(s) / 2
+	if len(s)%2 == 0 {
+		return (s[mid-1] + s[mid]) / 2
+	}
+	return s[mid]
+}
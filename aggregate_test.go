@@ -0,0 +1,126 @@
+package sds011
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSenseN(t *testing.T) {
+	c := &fakeConn{
+		replies: [][]byte{
+			queryResponse(40, 180),
+			nil, // The sensor misses a query.
+			queryResponse(10000, 190),
+			queryResponse(60, 200),
+		},
+	}
+	d := NewWithConn(c, WithReadTimeout(20*time.Millisecond), WithRangeCheck())
+
+	got, err := d.SenseN(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Measurement{
+		{PM25: 4, PM10: 18, DeviceID: 0xa160},
+		{PM25: 6, PM10: 20, DeviceID: 0xa160},
+	}
+	if diff := cmp.Diff(want, got, cmpFloats, ignoreTime); diff != "" {
+		t.Errorf("Unexpected result (-want +got):\n%s", diff)
+	}
+}
+
+func TestSenseNPartial(t *testing.T) {
+	c := &fakeConn{
+		replies: [][]byte{queryResponse(40, 180)},
+	}
+	d := NewWithConn(c, WithReadTimeout(20*time.Millisecond))
+
+	got, err := d.SenseN(3)
+	if err != ErrTimeout {
+		t.Errorf("got error %v, want %v", err, ErrTimeout)
+	}
+
+	want := []Measurement{{PM25: 4, PM10: 18, DeviceID: 0xa160}}
+	if diff := cmp.Diff(want, got, cmpFloats, ignoreTime); diff != "" {
+		t.Errorf("Unexpected result (-want +got):\n%s", diff)
+	}
+	if got, want := len(c.written), 5; got != want {
+		t.Errorf("got %v queries, want %v", got, want)
+	}
+}
+
+func TestSenseAverage(t *testing.T) {
+	c := &fakeConn{
+		replies: [][]byte{
+			queryResponse(40, 180),
+			nil, // The sensor misses a query.
+			queryResponse(50, 190),
+			queryResponse(60, 200),
+		},
+	}
+	d := newFakeDev(c)
+
+	got, err := d.SenseAverage(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Measurement{PM25: 5, PM10: 19, DeviceID: 0xa160}
+	if diff := cmp.Diff(want, got, cmpFloats, ignoreTime); diff != "" {
+		t.Errorf("Unexpected result (-want +got):\n%s", diff)
+	}
+}
+
+func TestSenseAverageNoReadings(t *testing.T) {
+	d := newFakeDev(&fakeConn{})
+
+	if _, err := d.SenseAverage(1); err != ErrTimeout {
+		t.Errorf("got error %v, want %v", err, ErrTimeout)
+	}
+}
+
+func TestSenseMedian(t *testing.T) {
+	cases := []struct {
+		name    string
+		replies [][]byte
+		want    Measurement
+	}{
+		{
+			"odd with outlier",
+			[][]byte{
+				queryResponse(40, 180),
+				queryResponse(9999, 9999),
+				queryResponse(50, 170),
+			},
+			Measurement{PM25: 5, PM10: 18, DeviceID: 0xa160},
+		},
+		{
+			"even with outlier",
+			[][]byte{
+				queryResponse(40, 180),
+				queryResponse(50, 190),
+				queryResponse(9999, 0),
+				queryResponse(60, 200),
+			},
+			Measurement{PM25: 5.5, PM10: 18.5, DeviceID: 0xa160},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			d := newFakeDev(&fakeConn{replies: tc.replies})
+
+			got, err := d.SenseMedian(len(tc.replies))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if diff := cmp.Diff(tc.want, got, cmpFloats, ignoreTime); diff != "" {
+				t.Errorf("Unexpected result (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
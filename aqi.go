@@ -0,0 +1,128 @@
+package sds011
+
+import "math"
+
+// breakpoint maps a concentration range onto an index range.
+type breakpoint struct {
+	cLow, cHigh float64
+	iLow, iHigh int
+}
+
+// US EPA breakpoints for 24-hour average PM2.5 and PM10, from the 2012 revision of the AQI.
+// Technical Assistance Document for the Reporting of Daily Air Quality (EPA-454/B-18-007).
+var (
+	pm25Breakpoints = []breakpoint{
+		{0.0, 12.0, 0, 50},
+		{12.1, 35.4, 51, 100},
+		{35.5, 55.4, 101, 150},
+		{55.5, 150.4, 151, 200},
+		{150.5, 250.4, 201, 300},
+		{250.5, 350.4, 301, 400},
+		{350.5, 500.4, 401, 500},
+	}
+
+	pm10Breakpoints = []breakpoint{
+		{0, 54, 0, 50},
+		{55, 154, 51, 100},
+		{155, 254, 101, 150},
+		{255, 354, 151, 200},
+		{355, 424, 201, 300},
+		{425, 504, 301, 400},
+		{505, 604, 401, 500},
+	}
+)
+
+// CAQI grids for hourly PM2.5 and PM10, from the 2012 CiteairII revision of the Common Air Quality Index. Bands
+// share their boundaries, and the top band covers index values 75 to 100 ("high"); anything above is "very high".
+var (
+	pm25CAQIGrid = []breakpoint{
+		{0, 15, 0, 25},
+		{15, 30, 25, 50},
+		{30, 55, 50, 75},
+		{55, 110, 75, 100},
+	}
+
+	pm10CAQIGrid = []breakpoint{
+		{0, 25, 0, 25},
+		{25, 50, 25, 50},
+		{50, 90, 50, 75},
+		{90, 180, 75, 100},
+	}
+)
+
+// AQI returns the US EPA Air Quality Index for the measurement, which is the higher of the PM2.5 and PM10
+// sub-indices. The EPA defines the AQI on 24-hour averages, so passing a single reading gives only an
+// approximation. Concentrations above the top breakpoint are clamped to an AQI of 500.
+func (m Measurement) AQI() int {
+	pm25 := subIndex(truncate(float64(m.PM25), 1), pm25Breakpoints)
+	pm10 := subIndex(truncate(float64(m.PM10), 0), pm10Breakpoints)
+	if pm25 > pm10 {
+		return pm25
+	}
+	return pm10
+}
+
+// CAQI returns the European Common Air Quality Index for the measurement using the hourly grid, which is the
+// higher of the PM2.5 and PM10 sub-indices. The grid is defined on hourly averages, so passing a single reading
+// gives only an approximation. The index is open-ended: concentrations above the top of the grid give values
+// above 100, extrapolated from the highest band.
+func (m Measurement) CAQI() int {
+	pm25 := caqiSubIndex(float64(m.PM25), pm25CAQIGrid)
+	pm10 := caqiSubIndex(float64(m.PM10), pm10CAQIGrid)
+	if pm25 > pm10 {
+		return pm25
+	}
+	return pm10
+}
+
+func caqiSubIndex(c float64, grid []breakpoint) int {
+	if top := grid[len(grid)-1]; c > top.cHigh {
+		return int(math.Round(interpolate(c, top)))
+	}
+	return subIndex(c, grid)
+}
+
+// AQICategory returns the name of the EPA category that the measurement's AQI falls in.
+func (m Measurement) AQICategory() string {
+	aqi := m.AQI()
+	switch {
+	case aqi <= 50:
+		return "Good"
+	case aqi <= 100:
+		return "Moderate"
+	case aqi <= 150:
+		return "Unhealthy for Sensitive Groups"
+	case aqi <= 200:
+		return "Unhealthy"
+	case aqi <= 300:
+		return "Very Unhealthy"
+	default:
+		return "Hazardous"
+	}
+}
+
+// subIndex linearly interpolates the concentration c within the band of bps that contains it.
+func subIndex(c float64, bps []breakpoint) int {
+	if c <= 0 {
+		return 0
+	}
+
+	for _, bp := range bps {
+		if c <= bp.cHigh {
+			return int(math.Round(interpolate(c, bp)))
+		}
+	}
+	return bps[len(bps)-1].iHigh
+}
+
+// interpolate linearly maps the concentration c onto bp's index range.
+func interpolate(c float64, bp breakpoint) float64 {
+	return float64(bp.iHigh-bp.iLow)/(bp.cHigh-bp.cLow)*(c-bp.cLow) + float64(bp.iLow)
+}
+
+// truncate truncates v to the given number of decimal places, as the EPA specifies. The small offset
+// guards against values such as 35.4 being represented as 35.39999.
+func truncate(v float64, places int) float64 {
+	p := math.Pow(10, float64(places))
+	return math.Floor(v*p+1e-4) / p
+}
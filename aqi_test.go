@@ -0,0 +1,98 @@
+package sds011
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestAQI(t *testing.T) {
+	cases := []struct {
+		pm25 float32
+		pm10 float32
+		want int
+	}{
+		{0, 0, 0},
+		{6.0, 0, 25},
+		{12.0, 0, 50},
+		{12.1, 0, 51},
+		{35.4, 0, 100},
+		{35.5, 0, 101},
+		{55.4, 0, 150},
+		{55.5, 0, 151},
+		{500.4, 0, 500},
+		{999.9, 0, 500},
+		{0, 54, 50},
+		{0, 54.9, 50},
+		{0, 55, 51},
+		{0, 154, 100},
+		{0, 604, 500},
+		{0, 999.9, 500},
+		// The higher of the two sub-indices wins.
+		{12.0, 154, 100},
+		{55.4, 54, 150},
+	}
+
+	for _, tc := range cases {
+		t.Run(fmt.Sprintf("%v_%v", tc.pm25, tc.pm10), func(t *testing.T) {
+			m := Measurement{PM25: tc.pm25, PM10: tc.pm10}
+			if got := m.AQI(); got != tc.want {
+				t.Errorf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCAQI(t *testing.T) {
+	cases := []struct {
+		pm25 float32
+		pm10 float32
+		want int
+	}{
+		{0, 0, 0},
+		{7.5, 0, 13},
+		{15, 0, 25},
+		{30, 0, 50},
+		{42.5, 0, 63},
+		{110, 0, 100},
+		{165, 0, 125},
+		{0, 25, 25},
+		{0, 70, 63},
+		{0, 180, 100},
+		{0, 270, 125},
+		// The higher of the two sub-indices wins.
+		{15, 50, 50},
+		{55, 50, 75},
+	}
+
+	for _, tc := range cases {
+		t.Run(fmt.Sprintf("%v_%v", tc.pm25, tc.pm10), func(t *testing.T) {
+			m := Measurement{PM25: tc.pm25, PM10: tc.pm10}
+			if got := m.CAQI(); got != tc.want {
+				t.Errorf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestAQICategory(t *testing.T) {
+	cases := []struct {
+		pm25 float32
+		want string
+	}{
+		{12.0, "Good"},
+		{35.4, "Moderate"},
+		{55.4, "Unhealthy for Sensitive Groups"},
+		{150.4, "Unhealthy"},
+		{250.4, "Very Unhealthy"},
+		{250.5, "Hazardous"},
+	}
+
+	for _, tc := range cases {
+		t.Run(fmt.Sprintf("%v", tc.pm25), func(t *testing.T) {
+			m := Measurement{PM25: tc.pm25}
+			if got := m.AQICategory(); got != tc.want {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package sds011
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMarshalBinary(t *testing.T) {
+	m := Measurement{PM25: 1.5, PM10: 2, DeviceID: 0xa160, Time: time.Unix(1, 2)}
+
+	got, err := m.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []byte{
+		0x00, 0x00, 0xc0, 0x3f,
+		0x00, 0x00, 0x00, 0x40,
+		0x60, 0xa1,
+		0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x02, 0x00, 0x00, 0x00,
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("got %v, want %v", fmtBytes(got), fmtBytes(want))
+	}
+}
+
+func TestBinaryRoundTrip(t *testing.T) {
+	cases := []struct {
+		name string
+		m    Measurement
+	}{
+		{"zero", Measurement{}},
+		{"values only", Measurement{PM25: 12.3, PM10: 45.6}},
+		{"all fields", Measurement{PM25: 12.3, PM10: 999.9, DeviceID: 0xa160,
+			Time: time.Date(2021, 3, 4, 5, 6, 7, 123456789, time.UTC)}},
+		{"before epoch", Measurement{PM25: 0.1, Time: time.Date(1960, 1, 1, 0, 0, 0, 5, time.UTC)}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			b, err := c.m.MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got Measurement
+			if err := got.UnmarshalBinary(b); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(c.m, got, ignoreRaw); diff != "" {
+				t.Errorf("Unexpected result (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestUnmarshalBinaryBadLength(t *testing.T) {
+	var m Measurement
+	if err := m.UnmarshalBinary(make([]byte, binaryLength-1)); err == nil {
+		t.Error("got nil error, want an error")
+	}
+}
@@ -42,6 +42,7 @@ func main() {
 		log.Println(err)
 		os.Exit(1)
 	}
+	defer d.Close()
 
 	if err := d.Wake(); err != nil {
 		log.Println(err)
@@ -70,7 +71,7 @@ func main() {
 	}
 }
 
-func active(d sds011.Dev) (sds011.Measurement, error) {
+func active(d sds011.Sensor) (sds011.Measurement, error) {
 	if err := d.SetMode(sds011.ModeQuery); err != nil {
 		return sds011.Measurement{}, err
 	}
@@ -93,7 +94,7 @@ func active(d sds011.Dev) (sds011.Measurement, error) {
 	return m, err
 }
 
-func listen(d sds011.Dev) error {
+func listen(d sds011.Sensor) error {
 	if err := d.SetMode(sds011.ModeActive); err != nil {
 		return err
 	}
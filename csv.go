@@ -0,0 +1,46 @@
+package sds011
+
+import (
+	"encoding/csv"
+	"io"
+	"sync"
+	"time"
+)
+
+// CSVLogger writes measurements to a CSV file, one row per measurement. It's safe for concurrent use.
+type CSVLogger struct {
+	mu sync.Mutex
+	w  *csv.Writer
+}
+
+// NewCSVLogger returns a CSVLogger that writes to w, and writes the header row (time,pm25,pm10).
+func NewCSVLogger(w io.Writer) (*CSVLogger, error) {
+	l := &CSVLogger{w: csv.NewWriter(w)}
+	if err := l.write([]string{"time", "pm25", "pm10"}); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Log writes a row for m. The time is formatted as RFC 3339 with nanoseconds, and is empty if m.Time is zero.
+// Concentrations have one decimal place, which is the sensor's resolution. Each row is flushed as it's written so
+// that it isn't lost if the program exits.
+func (l *CSVLogger) Log(m Measurement) error {
+	var t string
+	if !m.Time.IsZero() {
+		t = m.Time.Format(time.RFC3339Nano)
+	}
+
+	return l.write([]string{t, string(formatConcentration(m.PM25)), string(formatConcentration(m.PM10))})
+}
+
+func (l *CSVLogger) write(record []string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.w.Write(record); err != nil {
+		return err
+	}
+	l.w.Flush()
+	return l.w.Error()
+}
@@ -0,0 +1,42 @@
+package sds011
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCSVLogger(t *testing.T) {
+	var b strings.Builder
+	l, err := NewCSVLogger(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, m := range []Measurement{
+		{PM25: 4.5, PM10: 18.4, Time: time.Date(2021, 3, 4, 5, 6, 7, 500000000, time.UTC)},
+		{PM25: 12, PM10: 999.9},
+	} {
+		if err := l.Log(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := "time,pm25,pm10\n2021-03-04T05:06:07.5Z,4.5,18.4\n,12.0,999.9\n"
+	if got := b.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+type errWriter struct{}
+
+func (errWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("write failed")
+}
+
+func TestCSVLoggerWriteError(t *testing.T) {
+	if _, err := NewCSVLogger(errWriter{}); err == nil {
+		t.Error("got nil error, want an error")
+	}
+}
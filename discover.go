@@ -0,0 +1,66 @@
+package sds011
+
+import (
+	"time"
+
+	serial "github.com/albenik/go-serial/v2"
+)
+
+// Timeouts used when probing a port for a sensor. They're short so that scanning many ports is fast.
+const (
+	probeReadTimeout     = 500 * time.Millisecond
+	probePortReadTimeout = 100 * time.Millisecond
+)
+
+// listPorts and openDev list and open serial ports. They're variables so that tests can replace them.
+var (
+	listPorts = serial.GetPortsList
+	openDev   = New
+)
+
+// Discover returns the names of the serial ports that have an SDS011 attached. Each serial port is probed with
+// Ping, which finds the sensor whether it's awake or asleep and doesn't change its state.
+func Discover() ([]string, error) {
+	ports, err := listPorts()
+	if err != nil {
+		return nil, err
+	}
+
+	var found []string
+	for _, name := range ports {
+		if probe(name) {
+			found = append(found, name)
+		}
+	}
+	return found, nil
+}
+
+// Open opens the first serial port found to have an SDS011 attached. It returns ErrNotFound if there isn't one.
+// Ports are probed with opts, so options such as WithBaudRate apply to the probe too.
+func Open(opts ...Option) (*Dev, error) {
+	ports, err := listPorts()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range ports {
+		if probe(name, opts...) {
+			return openDev(name, opts...)
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// probe reports whether an SDS011 responds on the named serial port when opened with opts. The probe timeouts
+// override any timeouts in opts.
+func probe(name string, opts ...Option) bool {
+	opts = append(opts[:len(opts):len(opts)], WithReadTimeout(probeReadTimeout),
+		WithPortReadTimeout(probePortReadTimeout))
+	d, err := openDev(name, opts...)
+	if err != nil {
+		return false
+	}
+	defer d.Close()
+
+	return d.Ping() == nil
+}
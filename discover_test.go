@@ -0,0 +1,93 @@
+package sds011
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// opened records a call to openDev.
+type opened struct {
+	name        string
+	baudRate    int
+	readTimeout time.Duration
+}
+
+// fakePorts replaces listPorts and openDev with fakes in which only the named port has a sensor attached. Port
+// "missing" can't be opened and any other port doesn't respond as a sensor. It returns a func that restores the
+// originals and the calls made to openDev.
+func fakePorts(sensor string, ports ...string) (func(), *[]opened) {
+	origList, origOpen := listPorts, openDev
+	var calls []opened
+
+	listPorts = func() ([]string, error) {
+		return ports, nil
+	}
+	openDev = func(name string, opts ...Option) (*Dev, error) {
+		var o options
+		for _, opt := range opts {
+			opt(&o)
+		}
+		calls = append(calls, opened{name, o.baudRate, o.readTimeout})
+
+		switch name {
+		case "missing":
+			return nil, errors.New("no such port")
+		case sensor:
+			return NewWithConn(&fakeConn{respond: echo(nil)}, opts...), nil
+		default:
+			return NewWithConn(&fakeConn{readErr: errors.New("not a sensor")}, opts...), nil
+		}
+	}
+
+	return func() {
+		listPorts, openDev = origList, origOpen
+	}, &calls
+}
+
+func TestDiscover(t *testing.T) {
+	restore, _ := fakePorts("ttyUSB1", "missing", "ttyUSB0", "ttyUSB1")
+	defer restore()
+
+	got, err := Discover()
+	if err != nil {
+		t.Fatalf("Discover returned error: %v", err)
+	}
+	if diff := cmp.Diff([]string{"ttyUSB1"}, got); diff != "" {
+		t.Errorf("Unexpected result (-want +got):\n%s", diff)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	restore, calls := fakePorts("ttyUSB1", "missing", "ttyUSB0", "ttyUSB1")
+	defer restore()
+
+	d, err := Open(WithBaudRate(19200), WithReadTimeout(5*time.Second))
+	if err != nil {
+		t.Fatalf("Open returned error: %v", err)
+	}
+	defer d.Close()
+
+	// Each port is probed with the given options and the short probe timeout, and then the sensor's port is opened
+	// with the given options alone.
+	want := []opened{
+		{"missing", 19200, probeReadTimeout},
+		{"ttyUSB0", 19200, probeReadTimeout},
+		{"ttyUSB1", 19200, probeReadTimeout},
+		{"ttyUSB1", 19200, 5 * time.Second},
+	}
+	if diff := cmp.Diff(want, *calls, cmp.AllowUnexported(opened{})); diff != "" {
+		t.Errorf("Unexpected calls (-want +got):\n%s", diff)
+	}
+}
+
+func TestOpenNotFound(t *testing.T) {
+	restore, _ := fakePorts("ttyUSB1", "missing", "ttyUSB0")
+	defer restore()
+
+	if _, err := Open(); err != ErrNotFound {
+		t.Errorf("Open returned %v, want %v", err, ErrNotFound)
+	}
+}
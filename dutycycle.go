@@ -0,0 +1,65 @@
+package sds011
+
+import (
+	"context"
+	"time"
+)
+
+// SampleEvery duty-cycles the sensor, which extends the life of its laser. Every interval it wakes the sensor,
+// waits warmup for the airflow to settle, takes a reading, and puts the sensor back to sleep until the next
+// interval. Readings are passed to h synchronously. A reading that times out is skipped.
+//
+// With WithKeepAwake the sensor is left awake between readings instead, and it's only woken and warmed up if it
+// isn't already known to be awake.
+//
+// The sensor should be in ModeQuery. SampleEvery runs until ctx is done or a command fails, and it always tries
+// to leave the sensor asleep when it returns.
+func (d *Dev) SampleEvery(ctx context.Context, interval, warmup time.Duration, h Handler) (err error) {
+	defer func() {
+		if sleepErr := d.Sleep(); sleepErr != nil && (err == nil || err == ctx.Err()) {
+			err = sleepErr
+		}
+	}()
+
+	for {
+		start := time.Now()
+
+		if awake, _ := d.awakeState(); !d.keepAwake || !awake {
+			if err := d.WakeContext(ctx); err != nil {
+				return err
+			}
+			if err := sleepContext(ctx, warmup); err != nil {
+				return err
+			}
+		}
+
+		m, err := d.SenseContext(ctx)
+		if err != nil && err != ErrTimeout {
+			return err
+		} else if err == nil {
+			h(m)
+		}
+
+		if !d.keepAwake {
+			if err := d.SleepContext(ctx); err != nil {
+				return err
+			}
+		}
+		if err := sleepContext(ctx, time.Until(start.Add(interval))); err != nil {
+			return err
+		}
+	}
+}
+
+// sleepContext pauses for duration t or until ctx is done, in which case it returns ctx.Err().
+func sleepContext(ctx context.Context, t time.Duration) error {
+	timer := time.NewTimer(t)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
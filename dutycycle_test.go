@@ -0,0 +1,66 @@
+package sds011
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSampleEvery(t *testing.T) {
+	c := &fakeConn{respond: echo(queryResponse(50, 190))}
+	d := newFakeDev(c)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var n int
+	err := d.SampleEvery(ctx, 10*time.Millisecond, time.Millisecond, func(m Measurement) {
+		n++
+		if n == 2 {
+			cancel()
+		}
+	})
+	if err != context.Canceled {
+		t.Errorf("got error %v, want %v", err, context.Canceled)
+	}
+
+	// The sensor must be left asleep.
+	last := c.written[len(c.written)-1]
+	if command(last[2]) != sleepWorkCommand || last[3] != 0x01 || last[4] != 0x00 {
+		t.Errorf("got last command %v, want sleep", fmtBytes(last))
+	}
+}
+
+func TestSampleEveryKeepAwake(t *testing.T) {
+	c := &fakeConn{respond: echo(queryResponse(50, 190))}
+	d := NewWithConn(c, WithReadTimeout(100*time.Millisecond), WithKeepAwake())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var n int
+	err := d.SampleEvery(ctx, time.Millisecond, time.Millisecond, func(m Measurement) {
+		n++
+		if n == 3 {
+			cancel()
+		}
+	})
+	if err != context.Canceled {
+		t.Errorf("got error %v, want %v", err, context.Canceled)
+	}
+
+	// The sensor is woken once, sampled three times, and put to sleep on return.
+	var got []string
+	for _, w := range c.written {
+		switch {
+		case command(w[2]) == queryCommand:
+			got = append(got, "query")
+		case command(w[2]) == sleepWorkCommand && w[4] == 0x01:
+			got = append(got, "wake")
+		case command(w[2]) == sleepWorkCommand && w[4] == 0x00:
+			got = append(got, "sleep")
+		}
+	}
+	want := []string{"wake", "query", "query", "query", "sleep"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Unexpected commands (-want +got):\n%s", diff)
+	}
+}
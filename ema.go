@@ -0,0 +1,44 @@
+package sds011
+
+import (
+	"fmt"
+	"sync"
+)
+
+// EMA smooths a stream of measurements with an exponential moving average. It's safe for concurrent use.
+type EMA struct {
+	alpha float32
+
+	mu     sync.Mutex
+	seeded bool
+	pm25   float32
+	pm10   float32
+}
+
+// NewEMA returns an EMA with the given smoothing factor, which must be in (0, 1]. Each update moves the average
+// alpha of the way towards the new measurement, so smaller values give smoother but slower-moving output. It
+// panics if alpha is out of range.
+func NewEMA(alpha float32) *EMA {
+	if !(alpha > 0 && alpha <= 1) {
+		panic(fmt.Sprintf("sds011: EMA alpha must be in (0, 1], got %v", alpha))
+	}
+	return &EMA{alpha: alpha}
+}
+
+// Update adds m to the average and returns m with its PM2.5 and PM10 replaced by the smoothed values. The first
+// measurement seeds the average and is returned unchanged.
+func (e *EMA) Update(m Measurement) Measurement {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if !e.seeded {
+		e.pm25, e.pm10 = m.PM25, m.PM10
+		e.seeded = true
+	} else {
+		e.pm25 += e.alpha * (m.PM25 - e.pm25)
+		e.pm10 += e.alpha * (m.PM10 - e.pm10)
+	}
+
+	m.PM25, m.PM10 = e.pm25, e.pm10
+	return m
+}
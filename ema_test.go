@@ -0,0 +1,45 @@
+package sds011
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestEMA(t *testing.T) {
+	e := NewEMA(0.5)
+
+	in := []Measurement{
+		{PM25: 10, PM10: 20, DeviceID: 0xa160},
+		{PM25: 20, PM10: 20, DeviceID: 0xa160},
+		{PM25: 20, PM10: 40, DeviceID: 0xa160},
+		{PM25: 0, PM10: 0, DeviceID: 0xa160},
+	}
+	want := []Measurement{
+		{PM25: 10, PM10: 20, DeviceID: 0xa160},
+		{PM25: 15, PM10: 20, DeviceID: 0xa160},
+		{PM25: 17.5, PM10: 30, DeviceID: 0xa160},
+		{PM25: 8.75, PM10: 15, DeviceID: 0xa160},
+	}
+
+	var got []Measurement
+	for _, m := range in {
+		got = append(got, e.Update(m))
+	}
+	if diff := cmp.Diff(want, got, cmpFloats); diff != "" {
+		t.Errorf("Unexpected result (-want +got):\n%s", diff)
+	}
+}
+
+func TestNewEMAPanics(t *testing.T) {
+	for _, alpha := range []float32{0, -0.5, 1.5} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("NewEMA(%v) didn't panic", alpha)
+				}
+			}()
+			NewEMA(alpha)
+		}()
+	}
+}
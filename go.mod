@@ -6,6 +6,7 @@ require (
 	github.com/albenik/go-serial/v2 v2.5.1
 	github.com/google/go-cmp v0.5.6
 	github.com/kr/pretty v0.3.0 // indirect
+	github.com/prometheus/client_golang v1.11.1
 	github.com/rogpeppe/go-internal v1.8.0 // indirect
 	go.uber.org/atomic v1.10.0 // indirect
 	go.uber.org/multierr v1.8.0 // indirect
@@ -0,0 +1,203 @@
+package sds011
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// BufferedHandler returns a Handler that queues measurements for h, which is called with them in order by a single
+// goroutine. The queue holds up to bufSize measurements, and when it's full the oldest is dropped to make room, so
+// a slow h never blocks the caller or holds more than bufSize measurements in memory. It panics if bufSize isn't
+// positive.
+//
+// The returned stop function waits for h to handle the queued measurements and then ends the goroutine. Measurements
+// passed to the Handler after stop is called are dropped.
+func BufferedHandler(bufSize int, h Handler) (Handler, func()) {
+	if bufSize < 1 {
+		panic(fmt.Sprintf("sds011: buffer size must be positive, got %v", bufSize))
+	}
+
+	queue := make(chan Measurement, bufSize)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for m := range queue {
+			h(m)
+		}
+	}()
+
+	// mu serializes senders so that dropping the oldest measurement and queueing the new one happen together, and
+	// guards stopped.
+	var mu sync.Mutex
+	stopped := false
+
+	buffered := func(m Measurement) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if stopped {
+			return
+		}
+		for {
+			select {
+			case queue <- m:
+				return
+			default:
+			}
+
+			// The queue is full. The worker may take a measurement meanwhile, in which case there's nothing to drop.
+			select {
+			case <-queue:
+			default:
+			}
+		}
+	}
+
+	stop := func() {
+		mu.Lock()
+		if !stopped {
+			stopped = true
+			close(queue)
+		}
+		mu.Unlock()
+
+		<-done
+	}
+
+	return buffered, stop
+}
+
+// Throttle returns a Handler that passes measurements to h at most once per interval, dropping those that arrive
+// sooner after the last one passed. Measurements are timed by their Time field, or by when they arrive if it's
+// zero. The returned Handler is safe for concurrent use.
+func Throttle(interval time.Duration, h Handler) Handler {
+	var mu sync.Mutex
+	var last time.Time
+
+	return func(m Measurement) {
+		t := m.Time
+		if t.IsZero() {
+			t = time.Now()
+		}
+
+		mu.Lock()
+		if !last.IsZero() && t.Sub(last) < interval {
+			mu.Unlock()
+			return
+		}
+		last = t
+		mu.Unlock()
+
+		h(m)
+	}
+}
+
+// AlertOn returns a Handler that calls onCross when PM2.5 rises above pm25Limit or PM10 rises above pm10Limit, in
+// μg/m³. A limit that isn't positive disables alerting on that pollutant. Each pollutant is tracked separately,
+// and onCross is called only on a rising edge: once a pollutant has crossed its limit it must fall below the limit
+// minus hysteresis before it can trigger again, so that readings hovering around a limit don't cause a stream of
+// alerts. A measurement that's already above a limit when alerting starts counts as crossing it. onCross is called
+// once for a measurement that crosses both limits.
+//
+// The returned Handler is safe for concurrent use, but measurements should be passed to it in order, for example
+// by ListenOrdered or WithSynchronousHandler.
+func AlertOn(pm25Limit, pm10Limit, hysteresis float32, onCross func(Measurement)) Handler {
+	var mu sync.Mutex
+	var pm25Above, pm10Above bool
+
+	// crossed updates whether v is above limit and reports whether it just rose above it.
+	crossed := func(v, limit float32, above *bool) bool {
+		if limit <= 0 {
+			return false
+		}
+		if *above {
+			if v < limit-hysteresis {
+				*above = false
+			}
+			return false
+		}
+		*above = v > limit
+		return *above
+	}
+
+	return func(m Measurement) {
+		mu.Lock()
+		pm25 := crossed(m.PM25, pm25Limit, &pm25Above)
+		pm10 := crossed(m.PM10, pm10Limit, &pm10Above)
+		mu.Unlock()
+
+		if pm25 || pm10 {
+			onCross(m)
+		}
+	}
+}
+
+// Dedup returns a Handler that passes a measurement to h only if either of its concentrations differs from that of
+// the last measurement passed by more than threshold μg/m³, or it's from a different device. The first measurement
+// is always passed. Concentrations are compared at the sensor's resolution of 0.1 μg/m³, so a threshold of 0 drops
+// only exact repeats. Wrapping a handler that stores measurements with Dedup saves space while air quality is
+// stable without losing changes. The returned Handler is safe for concurrent use, but measurements should be
+// passed to it in order, for example by ListenOrdered or WithSynchronousHandler.
+func Dedup(threshold float32, h Handler) Handler {
+	limit := int(math.Round(float64(threshold) * 10))
+
+	var mu sync.Mutex
+	var last Measurement
+	var haveLast bool
+
+	differs := func(a, b uint16) bool {
+		d := int(a) - int(b)
+		return d > limit || -d > limit
+	}
+
+	return func(m Measurement) {
+		mu.Lock()
+		if haveLast && m.DeviceID == last.DeviceID && !differs(m.PM25Tenths(), last.PM25Tenths()) &&
+			!differs(m.PM10Tenths(), last.PM10Tenths()) {
+			mu.Unlock()
+			return
+		}
+		last = m
+		haveLast = true
+		mu.Unlock()
+
+		h(m)
+	}
+}
+
+// DetectGaps returns a Handler that passes every measurement to h, first calling onGap if the measurement arrived
+// more than twice interval after the one before it, which suggests that the sensor or the serial adapter dropped
+// packets. onGap is passed an estimate of how many were missed. Pass the ReportingInterval of the sensor's working
+// period as interval. Measurements are timed by their Time field, or by when they arrive if it's zero. The returned
+// Handler is safe for concurrent use, but measurements should be passed to it in order, for example by
+// ListenOrdered or WithSynchronousHandler. It panics if interval isn't positive.
+func DetectGaps(interval time.Duration, onGap func(missed int), h Handler) Handler {
+	if interval <= 0 {
+		panic(fmt.Sprintf("sds011: gap detection interval must be positive, got %v", interval))
+	}
+
+	var mu sync.Mutex
+	var last time.Time
+
+	return func(m Measurement) {
+		t := m.Time
+		if t.IsZero() {
+			t = time.Now()
+		}
+
+		mu.Lock()
+		var missed int
+		if gap := t.Sub(last); !last.IsZero() && gap > 2*interval {
+			missed = int(math.Round(float64(gap)/float64(interval))) - 1
+		}
+		last = t
+		mu.Unlock()
+
+		if missed > 0 {
+			onGap(missed)
+		}
+		h(m)
+	}
+}
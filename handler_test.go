@@ -0,0 +1,177 @@
+package sds011
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestBufferedHandler(t *testing.T) {
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	var got []float32
+	h, stop := BufferedHandler(2, func(m Measurement) {
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		<-release
+		got = append(got, m.PM25)
+	})
+
+	// Wait for the worker to block handling the first measurement. The queue holds two more, so measurements 2
+	// and 3 are dropped as later ones arrive.
+	h(Measurement{PM25: 1})
+	<-started
+	for i := 2; i <= 5; i++ {
+		h(Measurement{PM25: float32(i)})
+	}
+	close(release)
+	stop()
+
+	// Measurements passed after stop are dropped.
+	h(Measurement{PM25: 6})
+
+	if diff := cmp.Diff([]float32{1, 4, 5}, got); diff != "" {
+		t.Errorf("Unexpected measurements handled (-want +got):\n%s", diff)
+	}
+}
+
+func TestThrottle(t *testing.T) {
+	var got []float32
+	h := Throttle(30*time.Second, func(m Measurement) {
+		got = append(got, m.PM25)
+	})
+
+	start := time.Date(2021, 3, 4, 5, 6, 0, 0, time.UTC)
+	for i := 0; i < 75; i++ {
+		h(Measurement{PM25: float32(i), Time: start.Add(time.Duration(i) * time.Second)})
+	}
+
+	if diff := cmp.Diff([]float32{0, 30, 60}, got); diff != "" {
+		t.Errorf("Unexpected measurements handled (-want +got):\n%s", diff)
+	}
+}
+
+func TestAlertOn(t *testing.T) {
+	var got []Measurement
+	h := AlertOn(35, 50, 5, func(m Measurement) {
+		got = append(got, m)
+	})
+
+	for _, m := range []Measurement{
+		{PM25: 10, PM10: 20},
+		{PM25: 36, PM10: 40}, // PM2.5 crosses.
+		{PM25: 34, PM10: 40}, // Within the hysteresis band, so not re-armed.
+		{PM25: 37, PM10: 40},
+		{PM25: 29, PM10: 55}, // PM2.5 re-arms and PM10 crosses.
+		{PM25: 36, PM10: 60}, // PM2.5 crosses again.
+		{PM25: 10, PM10: 20},
+		{PM25: 40, PM10: 60}, // Both cross at once.
+	} {
+		h(m)
+	}
+
+	want := []Measurement{
+		{PM25: 36, PM10: 40},
+		{PM25: 29, PM10: 55},
+		{PM25: 36, PM10: 60},
+		{PM25: 40, PM10: 60},
+	}
+	if diff := cmp.Diff(want, got, cmpFloats); diff != "" {
+		t.Errorf("Unexpected alerts (-want +got):\n%s", diff)
+	}
+}
+
+func TestAlertOnDisabledLimit(t *testing.T) {
+	var n int
+	h := AlertOn(35, 0, 5, func(Measurement) {
+		n++
+	})
+
+	h(Measurement{PM25: 10, PM10: 999})
+	if n != 0 {
+		t.Errorf("got %v alerts, want 0", n)
+	}
+}
+
+func TestDedup(t *testing.T) {
+	var got []Measurement
+	h := Dedup(0.5, func(m Measurement) {
+		got = append(got, m)
+	})
+
+	for _, m := range []Measurement{
+		{PM25: 10, PM10: 20},
+		{PM25: 10.5, PM10: 20}, // Exactly the threshold.
+		{PM25: 9.6, PM10: 19.5},
+		{PM25: 10, PM10: 20.6}, // PM10 changed.
+		{PM25: 10, PM10: 20.6, DeviceID: 0xa160},
+		{PM25: 10.6, PM10: 20.6, DeviceID: 0xa160},
+		{PM25: 10.4, PM10: 20.6, DeviceID: 0xa160},
+	} {
+		h(m)
+	}
+
+	want := []Measurement{
+		{PM25: 10, PM10: 20},
+		{PM25: 10, PM10: 20.6},
+		{PM25: 10, PM10: 20.6, DeviceID: 0xa160},
+		{PM25: 10.6, PM10: 20.6, DeviceID: 0xa160},
+	}
+	if diff := cmp.Diff(want, got, cmpFloats); diff != "" {
+		t.Errorf("Unexpected measurements passed (-want +got):\n%s", diff)
+	}
+}
+
+func TestDetectGaps(t *testing.T) {
+	var gaps []int
+	var n int
+	h := DetectGaps(ReportingInterval(0), func(missed int) {
+		gaps = append(gaps, missed)
+	}, func(Measurement) {
+		n++
+	})
+
+	start := time.Date(2021, 3, 4, 5, 6, 0, 0, time.UTC)
+	for _, offset := range []time.Duration{
+		0,
+		time.Second,
+		2100 * time.Millisecond, // Late, but within twice the interval.
+		5 * time.Second,         // Two packets missed.
+		6 * time.Second,
+		16 * time.Second, // Nine packets missed.
+	} {
+		h(Measurement{Time: start.Add(offset)})
+	}
+
+	if diff := cmp.Diff([]int{2, 9}, gaps); diff != "" {
+		t.Errorf("Unexpected gaps (-want +got):\n%s", diff)
+	}
+	if n != 6 {
+		t.Errorf("got %v measurements handled, want 6", n)
+	}
+}
+
+func TestDetectGapsBadInterval(t *testing.T) {
+	for _, interval := range []time.Duration{0, -time.Second} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("DetectGaps(%v, ...) didn't panic", interval)
+				}
+			}()
+			DetectGaps(interval, func(int) {}, func(Measurement) {})
+		}()
+	}
+}
+
+func TestReportingInterval(t *testing.T) {
+	if got := ReportingInterval(0); got != time.Second {
+		t.Errorf("ReportingInterval(0) = %v, want 1s", got)
+	}
+	if got := ReportingInterval(5); got != 5*time.Minute {
+		t.Errorf("ReportingInterval(5) = %v, want 5m", got)
+	}
+}
@@ -0,0 +1,37 @@
+package sds011
+
+// Parameters of the humidity correction. kappa is the hygroscopicity of the aerosol and kappaDensity the ratio of
+// water density to dry particle density, from Crilley et al. (2018), "Evaluation of a low-cost optical particle
+// counter (Alphasense OPC-N2) for ambient air monitoring", Atmos. Meas. Tech., 11, 709–720.
+const (
+	kappa        = 0.4
+	kappaDensity = 1.65
+
+	// maxCorrectionRH is the highest relative humidity the correction is applied at. The growth factor diverges
+	// as RH approaches 100%, so higher values are clamped to this.
+	maxCorrectionRH = 95
+)
+
+// HumidityCorrected returns m with its concentrations corrected for hygroscopic particle growth at the given
+// relative humidity, in percent. Optical sensors such as the SDS011 see particles swollen with water and so
+// over-read in humid air; the corrected values estimate the dry concentration.
+//
+// It uses the κ-Köhler correction of Crilley et al. (2018) with κ = 0.4 and a density ratio of 1.65:
+//
+//	C_dry = C / (1 + (κ / 1.65) / (1/a_w - 1))
+//
+// where a_w is RH / 100. RH is clamped to [0, 95].
+func (m Measurement) HumidityCorrected(rh float32) Measurement {
+	if rh <= 0 {
+		return m
+	}
+	if rh > maxCorrectionRH {
+		rh = maxCorrectionRH
+	}
+
+	aw := float64(rh) / 100
+	growth := 1 + (kappa/kappaDensity)/(1/aw-1)
+	m.PM25 = float32(float64(m.PM25) / growth)
+	m.PM10 = float32(float64(m.PM10) / growth)
+	return m
+}
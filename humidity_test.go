@@ -0,0 +1,37 @@
+package sds011
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestHumidityCorrected(t *testing.T) {
+	m := Measurement{PM25: 10, PM10: 20, DeviceID: 0xa160}
+
+	cases := []struct {
+		name string
+		rh   float32
+		want Measurement
+	}{
+		{"dry", 0, Measurement{PM25: 10, PM10: 20, DeviceID: 0xa160}},
+		{"negative", -10, Measurement{PM25: 10, PM10: 20, DeviceID: 0xa160}},
+		// Growth factor is 1 + (0.4/1.65)/(1/0.5 - 1) = 1.242424...
+		{"50%", 50, Measurement{PM25: 8.04878, PM10: 16.09756, DeviceID: 0xa160}},
+		// Growth factor is 1 + (0.4/1.65)/(1/0.9 - 1) = 3.181818...
+		{"90%", 90, Measurement{PM25: 3.14286, PM10: 6.28571, DeviceID: 0xa160}},
+		// Clamped to 95%, where the growth factor is 1 + (0.4/1.65)*19 = 5.606060...
+		{"clamped", 100, Measurement{PM25: 1.78378, PM10: 3.56757, DeviceID: 0xa160}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := m.HumidityCorrected(c.rh)
+			if diff := cmp.Diff(c.want, got, cmp.Comparer(func(x, y float32) bool {
+				return x-y < 0.0001 && y-x < 0.0001
+			}), ignoreRaw); diff != "" {
+				t.Errorf("Unexpected result (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package sds011
+
+import (
+	"encoding/json"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// jsonMeasurement is the JSON representation of a Measurement. Concentrations are encoded with one decimal
+// place, which is the sensor's resolution, and the device ID and time are omitted when unset.
+type jsonMeasurement struct {
+	PM25     json.Number `json:"pm25"`
+	PM10     json.Number `json:"pm10"`
+	DeviceID uint16      `json:"device_id,omitempty"`
+	Time     *time.Time  `json:"time,omitempty"`
+}
+
+func (m Measurement) MarshalJSON() ([]byte, error) {
+	j := jsonMeasurement{
+		PM25:     formatConcentration(m.PM25),
+		PM10:     formatConcentration(m.PM10),
+		DeviceID: m.DeviceID,
+	}
+	if !m.Time.IsZero() {
+		j.Time = &m.Time
+	}
+
+	return json.Marshal(j)
+}
+
+func (m *Measurement) UnmarshalJSON(b []byte) error {
+	var j jsonMeasurement
+	if err := json.Unmarshal(b, &j); err != nil {
+		return err
+	}
+
+	pm25, err := parseConcentration(j.PM25)
+	if err != nil {
+		return err
+	}
+	pm10, err := parseConcentration(j.PM10)
+	if err != nil {
+		return err
+	}
+
+	*m = Measurement{
+		PM25:     pm25,
+		PM10:     pm10,
+		DeviceID: j.DeviceID,
+	}
+	if j.Time != nil {
+		m.Time = *j.Time
+	}
+	return nil
+}
+
+func formatConcentration(v float32) json.Number {
+	return json.Number(strconv.FormatFloat(float64(v), 'f', 1, 32))
+}
+
+func parseConcentration(n json.Number) (float32, error) {
+	if n == "" {
+		return 0, nil
+	}
+
+	v, err := strconv.ParseFloat(string(n), 32)
+	if err != nil {
+		return 0, err
+	}
+	return float32(v), nil
+}
+
+// JSONLWriter writes measurements as JSON Lines: one JSON object per line, in the format of
+// Measurement.MarshalJSON. It's safe for concurrent use.
+type JSONLWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewJSONLWriter returns a JSONLWriter that writes to w.
+func NewJSONLWriter(w io.Writer) *JSONLWriter {
+	return &JSONLWriter{w: w}
+}
+
+// Write writes m as a line of JSON. The line is written with a single call to the underlying writer, so lines
+// aren't interleaved or left partially written by a buffer. If the underlying writer has a Flush method, such as
+// a *bufio.Writer, then it's flushed after each line.
+func (j *JSONLWriter) Write(m Measurement) error {
+	b, err := m.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if _, err := j.w.Write(b); err != nil {
+		return err
+	}
+	if f, ok := j.w.(interface{ Flush() error }); ok {
+		return f.Flush()
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package sds011
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMarshalJSON(t *testing.T) {
+	cases := []struct {
+		name string
+		m    Measurement
+		want string
+	}{
+		{
+			"values only",
+			Measurement{PM25: 4.5, PM10: 18},
+			`{"pm25":4.5,"pm10":18.0}`,
+		},
+		{
+			"all fields",
+			Measurement{PM25: 4.5, PM10: 18.4, DeviceID: 0xa160, Time: time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)},
+			`{"pm25":4.5,"pm10":18.4,"device_id":41312,"time":"2021-03-04T05:06:07Z"}`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := json.Marshal(tc.m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tc.want {
+				t.Errorf("got %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	cases := []Measurement{
+		{},
+		{PM25: 0.1, PM10: 999.9},
+		{PM25: 4.5, PM10: 18.4, DeviceID: 0xa160, Time: time.Date(2021, 3, 4, 5, 6, 7, 8, time.UTC)},
+	}
+
+	for _, m := range cases {
+		t.Run(m.String(), func(t *testing.T) {
+			b, err := json.Marshal(m)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got Measurement
+			if err := json.Unmarshal(b, &got); err != nil {
+				t.Fatal(err)
+			}
+
+			if diff := cmp.Diff(m, got, ignoreRaw); diff != "" {
+				t.Errorf("Unexpected result (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestJSONLWriter(t *testing.T) {
+	var b bytes.Buffer
+	bw := bufio.NewWriter(&b)
+	w := NewJSONLWriter(bw)
+
+	for _, m := range []Measurement{
+		{PM25: 4.5, PM10: 18.4},
+		{PM25: 12, PM10: 30, DeviceID: 0xa160, Time: time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)},
+	} {
+		if err := w.Write(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Each line is flushed through the buffered writer as it's written.
+	want := `{"pm25":4.5,"pm10":18.4}
+{"pm25":12.0,"pm10":30.0,"device_id":41312,"time":"2021-03-04T05:06:07Z"}
+`
+	if got := b.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,49 @@
+package sds011
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	measurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `)
+	tagEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+)
+
+// LineProtocol encodes the measurement as a line of InfluxDB line protocol, with fields pm25 and pm10:
+//
+//	measurement,tag1=value1,tag2=value2 pm25=4.5,pm10=18.4 1615799167000000000
+//
+// Tags are sorted by key, as InfluxDB recommends, and tags with an empty key or value are omitted because the
+// protocol doesn't allow them. The timestamp is the measurement's time in nanoseconds; it's omitted if the time
+// is zero, in which case InfluxDB uses the time the line is received.
+func (m Measurement) LineProtocol(measurement string, tags map[string]string) string {
+	var b strings.Builder
+	b.WriteString(measurementEscaper.Replace(measurement))
+
+	keys := make([]string, 0, len(tags))
+	for k, v := range tags {
+		if k != "" && v != "" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		b.WriteByte(',')
+		b.WriteString(tagEscaper.Replace(k))
+		b.WriteByte('=')
+		b.WriteString(tagEscaper.Replace(tags[k]))
+	}
+
+	b.WriteString(" pm25=")
+	b.WriteString(strconv.FormatFloat(float64(m.PM25), 'f', -1, 32))
+	b.WriteString(",pm10=")
+	b.WriteString(strconv.FormatFloat(float64(m.PM10), 'f', -1, 32))
+
+	if !m.Time.IsZero() {
+		b.WriteByte(' ')
+		b.WriteString(strconv.FormatInt(m.Time.UnixNano(), 10))
+	}
+	return b.String()
+}
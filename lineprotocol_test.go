@@ -0,0 +1,55 @@
+package sds011
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLineProtocol(t *testing.T) {
+	ts := time.Date(2021, 3, 15, 9, 6, 7, 0, time.UTC)
+
+	cases := []struct {
+		name        string
+		m           Measurement
+		measurement string
+		tags        map[string]string
+		want        string
+	}{
+		{
+			"no tags or time",
+			Measurement{PM25: 4.5, PM10: 18.4},
+			"air",
+			nil,
+			"air pm25=4.5,pm10=18.4",
+		},
+		{
+			"tags and time",
+			Measurement{PM25: 4.5, PM10: 18, Time: ts},
+			"air",
+			map[string]string{"sensor": "a160", "location": "garden"},
+			"air,location=garden,sensor=a160 pm25=4.5,pm10=18 1615799167000000000",
+		},
+		{
+			"escaping",
+			Measurement{PM25: 4.5, PM10: 18.4},
+			"air quality,x=y",
+			map[string]string{"room name": "living room, east", "a=b": "c"},
+			`air\ quality\,x=y,a\=b=c,room\ name=living\ room\,\ east pm25=4.5,pm10=18.4`,
+		},
+		{
+			"empty tags omitted",
+			Measurement{PM25: 4.5, PM10: 18.4},
+			"air",
+			map[string]string{"": "x", "sensor": ""},
+			"air pm25=4.5,pm10=18.4",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.m.LineProtocol(tc.measurement, tc.tags); got != tc.want {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,189 @@
+package sds011
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// NamedHandler handles a measurement from the sensor with the given name.
+type NamedHandler func(name string, m Measurement)
+
+// Manager operates several sensors together, each identified by a name.
+type Manager struct {
+	mu   sync.Mutex
+	devs map[string]*Dev
+
+	// listenCtx is the context that ListenAll listens with, and cancelListen cancels it. Stop cancels it and clears
+	// both, so that a later ListenAll gets a new one. Guarded by mu.
+	listenCtx    context.Context
+	cancelListen context.CancelFunc
+}
+
+// ManagerError holds the errors returned by individual sensors, keyed by sensor name.
+type ManagerError map[string]error
+
+func (e ManagerError) Error() string {
+	names := make([]string, 0, len(e))
+	for name := range e {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	msgs := make([]string, len(names))
+	for i, name := range names {
+		msgs[i] = fmt.Sprintf("%s: %v", name, e[name])
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// NewManager returns a Manager with no sensors.
+func NewManager() *Manager {
+	return &Manager{devs: make(map[string]*Dev)}
+}
+
+// Add opens the sensor on the given serial port and adds it to the manager under the given name. If the name is
+// already taken then the port is closed again.
+func (m *Manager) Add(name, port string, opts ...Option) error {
+	d, err := New(port, opts...)
+	if err != nil {
+		return err
+	}
+	if err := m.AddDev(name, d); err != nil {
+		d.Close()
+		return err
+	}
+	return nil
+}
+
+// AddDev adds an already opened sensor to the manager under the given name.
+func (m *Manager) AddDev(name string, d *Dev) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.devs[name]; ok {
+		return fmt.Errorf("sds011: sensor %q already added", name)
+	}
+	m.devs[name] = d
+	return nil
+}
+
+// Dev returns the sensor with the given name, or nil if there isn't one.
+func (m *Manager) Dev(name string) *Dev {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.devs[name]
+}
+
+// snapshot returns a copy of the sensors so they can be used without holding m.mu.
+func (m *Manager) snapshot() map[string]*Dev {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	devs := make(map[string]*Dev, len(m.devs))
+	for name, d := range m.devs {
+		devs[name] = d
+	}
+	return devs
+}
+
+// each calls f concurrently for every sensor and collects the errors it returns. The returned error is nil or a
+// ManagerError.
+func (m *Manager) each(f func(name string, d *Dev) error) error {
+	var mu sync.Mutex
+	errs := make(ManagerError)
+
+	var wg sync.WaitGroup
+	for name, d := range m.snapshot() {
+		wg.Add(1)
+		go func(name string, d *Dev) {
+			defer wg.Done()
+
+			if err := f(name, d); err != nil {
+				mu.Lock()
+				errs[name] = err
+				mu.Unlock()
+			}
+		}(name, d)
+	}
+	wg.Wait()
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// SenseAll queries every sensor concurrently and returns their measurements keyed by name. A sensor that fails
+// doesn't stop the others: the measurements that were taken are returned along with a ManagerError holding the
+// failures.
+func (m *Manager) SenseAll() (map[string]Measurement, error) {
+	var mu sync.Mutex
+	ms := make(map[string]Measurement)
+
+	err := m.each(func(name string, d *Dev) error {
+		meas, err := d.Sense()
+		if err != nil {
+			return err
+		}
+
+		mu.Lock()
+		ms[name] = meas
+		mu.Unlock()
+		return nil
+	})
+	return ms, err
+}
+
+// ListenAll listens to every sensor concurrently, calling h with each measurement and the name of the sensor that
+// sent it. It blocks until every sensor has stopped listening, either because of Stop or because of an error,
+// and returns a ManagerError holding any errors.
+func (m *Manager) ListenAll(h NamedHandler) error {
+	ctx := m.listenContext()
+	return m.each(func(name string, d *Dev) error {
+		err := d.ListenContext(ctx, func(meas Measurement) {
+			h(name, meas)
+		})
+		if ctx.Err() != nil {
+			// Stopped by Stop.
+			return nil
+		}
+		return err
+	})
+}
+
+// listenContext returns the context for ListenAll to listen with, which Stop cancels.
+func (m *Manager) listenContext() context.Context {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.listenCtx == nil {
+		m.listenCtx, m.cancelListen = context.WithCancel(context.Background())
+	}
+	return m.listenCtx
+}
+
+// Stop stops every sensor listening. It stops a running ListenAll even if some of its sensors haven't started
+// listening yet.
+func (m *Manager) Stop() {
+	m.mu.Lock()
+	if m.cancelListen != nil {
+		m.cancelListen()
+		m.listenCtx, m.cancelListen = nil, nil
+	}
+	m.mu.Unlock()
+
+	for _, d := range m.snapshot() {
+		d.Stop()
+	}
+}
+
+// Close closes every sensor and returns a ManagerError holding any errors.
+func (m *Manager) Close() error {
+	return m.each(func(name string, d *Dev) error {
+		return d.Close()
+	})
+}
@@ -0,0 +1,108 @@
+package sds011
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestManagerSenseAll(t *testing.T) {
+	good := newFakeDev(&fakeConn{respond: echo(queryResponse(45, 184))})
+	bad := newFakeDev(&fakeConn{})
+
+	m := NewManager()
+	if err := m.AddDev("good", good); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AddDev("bad", bad); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AddDev("good", good); err == nil {
+		t.Error("adding a duplicate name succeeded, want an error")
+	}
+
+	got, err := m.SenseAll()
+
+	want := map[string]Measurement{"good": {PM25: 4.5, PM10: 18.4, DeviceID: 0xa160}}
+	if diff := cmp.Diff(want, got, cmpFloats, ignoreTime); diff != "" {
+		t.Errorf("Unexpected result (-want +got):\n%s", diff)
+	}
+
+	var merr ManagerError
+	if !errors.As(err, &merr) {
+		t.Fatalf("got error %v, want a ManagerError", err)
+	}
+	if len(merr) != 1 || merr["bad"] != ErrTimeout {
+		t.Errorf("got errors %v, want only a timeout from %q", merr, "bad")
+	}
+}
+
+func TestManagerListenAll(t *testing.T) {
+	m := NewManager()
+	for _, name := range []string{"a", "b"} {
+		d := newFakeDev(&fakeConn{buf: queryResponse(45, 184)})
+		if err := m.AddDev(name, d); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got := make(chan string, 2)
+	errc := make(chan error)
+	go func() {
+		errc <- m.ListenAll(func(name string, meas Measurement) {
+			got <- name
+		})
+	}()
+
+	seen := make(map[string]bool)
+	for len(seen) < 2 {
+		select {
+		case name := <-got:
+			seen[name] = true
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for measurements, got them from %v", seen)
+		}
+	}
+
+	m.Stop()
+	if err := <-errc; err != nil {
+		t.Errorf("ListenAll returned error: %v", err)
+	}
+}
+
+func TestManagerStopBeforeListening(t *testing.T) {
+	m := NewManager()
+	for _, name := range []string{"a", "b"} {
+		if err := m.AddDev(name, newFakeDev(&fakeConn{})); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	errc := make(chan error)
+	go func() {
+		errc <- m.ListenAll(func(name string, meas Measurement) {})
+	}()
+
+	// Stop as soon as ListenAll has started, which is likely before the sensors have started listening.
+	for {
+		m.mu.Lock()
+		started := m.listenCtx != nil
+		m.mu.Unlock()
+		if started {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	m.Stop()
+
+	select {
+	case err := <-errc:
+		if err != nil {
+			t.Errorf("ListenAll returned error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("ListenAll didn't return after Stop")
+	}
+}
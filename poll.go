@@ -0,0 +1,47 @@
+package sds011
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Poll queries the sensor every interval and passes each measurement to h, which is the counterpart of Listen for
+// a sensor in ModeQuery. The first query is sent immediately. h is called synchronously, and if a query and its
+// handler take longer than interval then the ticks missed meanwhile are skipped rather than queued.
+//
+// Queries that time out and measurements rejected by WithRangeCheck, WithStrictCheck, or WithSaturationCheck are
+// skipped. Poll runs until ctx is done, in which case it returns ctx.Err(), or until a query fails in some other
+// way.
+func (d *Dev) Poll(ctx context.Context, interval time.Duration, h Handler) error {
+	if interval <= 0 {
+		return fmt.Errorf("sds011: polling interval must be positive, got %v", interval)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		m, err := d.SenseContext(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err == nil {
+			h(m)
+		} else if err != ErrTimeout && !rejected(err) {
+			return err
+		}
+
+		// The ticker holds at most one tick, which is stale if this iteration overran the interval.
+		select {
+		case <-ticker.C:
+		default:
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
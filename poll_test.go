@@ -0,0 +1,47 @@
+package sds011
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPoll(t *testing.T) {
+	cases := []struct {
+		name     string
+		delay    time.Duration
+		min, max int
+	}{
+		{"fast handler", 0, 5, 11},
+		// The handler overruns each 10ms interval, so ticks are skipped rather than queued.
+		{"slow handler", 15 * time.Millisecond, 2, 6},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			d := newFakeDev(&fakeConn{respond: echo(queryResponse(45, 184))})
+
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+
+			n := 0
+			err := d.Poll(ctx, 10*time.Millisecond, func(m Measurement) {
+				n++
+				time.Sleep(tc.delay)
+			})
+			if err != context.DeadlineExceeded {
+				t.Errorf("got error %v, want %v", err, context.DeadlineExceeded)
+			}
+			if n < tc.min || n > tc.max {
+				t.Errorf("got %v measurements, want between %v and %v", n, tc.min, tc.max)
+			}
+		})
+	}
+}
+
+func TestPollBadInterval(t *testing.T) {
+	d := newFakeDev(&fakeConn{})
+	if err := d.Poll(context.Background(), 0, func(Measurement) {}); err == nil {
+		t.Error("got nil error, want an error")
+	}
+}
@@ -0,0 +1,105 @@
+// Package promcollector exports SDS011 measurements as Prometheus metrics. It's a separate package so that the
+// sds011 package doesn't depend on the Prometheus client library.
+package promcollector
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/mtraver/sds011"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// retryDelay is how long Run waits before listening again after a read error.
+var retryDelay = time.Second
+
+// Collector is a prometheus.Collector that exposes the latest measurement from a sensor in active mode as the
+// gauges sds011_pm25_micrograms and sds011_pm10_micrograms, along with the counter sds011_read_errors_total.
+type Collector struct {
+	dev        *sds011.Dev
+	staleAfter time.Duration
+
+	pm25       *prometheus.Desc
+	pm10       *prometheus.Desc
+	readErrors prometheus.Counter
+
+	mu   sync.Mutex
+	last sds011.Measurement
+}
+
+var _ prometheus.Collector = (*Collector)(nil)
+
+// New returns a Collector for d. The gauges are omitted from scrapes, which marks them stale in Prometheus, when
+// no measurement has arrived within staleAfter; this happens while the sensor is asleep. staleAfter should be
+// longer than the sensor's working period (about a second for a period of 0).
+func New(d *sds011.Dev, staleAfter time.Duration) *Collector {
+	return &Collector{
+		dev:        d,
+		staleAfter: staleAfter,
+		pm25: prometheus.NewDesc("sds011_pm25_micrograms",
+			"Latest PM2.5 concentration in micrograms per cubic meter.", nil, nil),
+		pm10: prometheus.NewDesc("sds011_pm10_micrograms",
+			"Latest PM10 concentration in micrograms per cubic meter.", nil, nil),
+		readErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "sds011_read_errors_total",
+			Help: "Number of failed reads from the sensor.",
+		}),
+	}
+}
+
+// Run listens to the sensor until ctx is done, recording each measurement. The sensor should be in active mode.
+// A read error is counted and listening resumes after a short delay. Run returns ctx.Err() when ctx is done, nil
+// if the Dev's Stop method is called, or an error if the device can't be listened to at all (for example because
+// it's closed).
+func (c *Collector) Run(ctx context.Context) error {
+	for {
+		err := c.dev.ListenContext(ctx, c.Observe)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err == nil || err == sds011.ErrClosed || err == sds011.ErrAlreadyListening {
+			return err
+		}
+		c.readErrors.Inc()
+
+		t := time.NewTimer(retryDelay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// Observe records m as the latest measurement. It's an sds011.Handler, so it may be used with any of the listen
+// methods in place of Run.
+func (c *Collector) Observe(m sds011.Measurement) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Handlers may run concurrently, so don't let an older measurement replace a newer one.
+	if m.Time.Before(c.last.Time) {
+		return
+	}
+	c.last = m
+}
+
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.pm25
+	ch <- c.pm10
+	c.readErrors.Describe(ch)
+}
+
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	last := c.last
+	c.mu.Unlock()
+
+	if !last.Time.IsZero() && time.Since(last.Time) <= c.staleAfter {
+		ch <- prometheus.MustNewConstMetric(c.pm25, prometheus.GaugeValue, float64(last.PM25))
+		ch <- prometheus.MustNewConstMetric(c.pm10, prometheus.GaugeValue, float64(last.PM10))
+	}
+	c.readErrors.Collect(ch)
+}
@@ -0,0 +1,86 @@
+package promcollector
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mtraver/sds011"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func gather(t *testing.T, c *Collector) map[string]float64 {
+	t.Helper()
+
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(c)
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := make(map[string]float64)
+	for _, f := range families {
+		for _, m := range f.GetMetric() {
+			if m.GetGauge() != nil {
+				got[f.GetName()] = m.GetGauge().GetValue()
+			} else {
+				got[f.GetName()] = m.GetCounter().GetValue()
+			}
+		}
+	}
+	return got
+}
+
+func TestCollect(t *testing.T) {
+	c := New(nil, time.Minute)
+
+	want := map[string]float64{"sds011_read_errors_total": 0}
+	if diff := cmp.Diff(want, gather(t, c)); diff != "" {
+		t.Errorf("Unexpected metrics before any measurement (-want +got):\n%s", diff)
+	}
+
+	c.Observe(sds011.Measurement{PM25: 4.5, PM10: 18, Time: time.Now()})
+	want = map[string]float64{
+		"sds011_pm25_micrograms":   4.5,
+		"sds011_pm10_micrograms":   18,
+		"sds011_read_errors_total": 0,
+	}
+	if diff := cmp.Diff(want, gather(t, c)); diff != "" {
+		t.Errorf("Unexpected metrics (-want +got):\n%s", diff)
+	}
+
+	// An old measurement is stale and isn't exported.
+	c = New(nil, time.Minute)
+	c.Observe(sds011.Measurement{PM25: 4.5, PM10: 18, Time: time.Now().Add(-2 * time.Minute)})
+	want = map[string]float64{"sds011_read_errors_total": 0}
+	if diff := cmp.Diff(want, gather(t, c)); diff != "" {
+		t.Errorf("Unexpected metrics for stale measurement (-want +got):\n%s", diff)
+	}
+}
+
+func TestRunStop(t *testing.T) {
+	d := sds011.NewSimulator(sds011.WithSimInterval(10 * time.Millisecond))
+	c := New(d, time.Minute)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Run(context.Background())
+	}()
+
+	// Stop once Run is listening, which it is once a measurement has been observed.
+	for len(gather(t, c)) == 1 {
+		time.Sleep(5 * time.Millisecond)
+	}
+	d.Stop()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("got error %v, want nil", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Run didn't return after Stop")
+	}
+}
@@ -0,0 +1,70 @@
+package sds011
+
+import (
+	"context"
+	"time"
+)
+
+// Bounds on the exponential backoff between reconnection attempts.
+var (
+	reconnectMinBackoff = time.Second
+	reconnectMaxBackoff = time.Minute
+)
+
+// WithAutoReconnect makes the listen methods recover from errors on the serial port, such as a USB-serial adapter
+// briefly disconnecting, instead of returning them. The port is closed and reopened by name, with exponential
+// backoff between attempts, until it opens or listening is stopped. onReconnect, if non-nil, is called after each
+// attempt with the attempt number (starting at 1) and its error, which is nil on success. Attempts are also logged
+// to the debug writer. Reconnecting is only possible for a Dev created by New.
+func WithAutoReconnect(onReconnect func(attempt int, err error)) Option {
+	return func(o *options) {
+		if onReconnect == nil {
+			onReconnect = func(int, error) {}
+		}
+		o.onReconnect = onReconnect
+	}
+}
+
+// reconnect reopens the serial port after cause, retrying until it succeeds or ctx is done.
+func (d *Dev) reconnect(ctx context.Context, cause error) error {
+	d.logf("reconnecting after error: %v", cause)
+	d.ioMu.Lock()
+	d.port.Close()
+	d.ioMu.Unlock()
+
+	backoff := reconnectMinBackoff
+	for attempt := 1; ; attempt++ {
+		d.ioMu.Lock()
+		baud := d.baudRate
+		d.ioMu.Unlock()
+
+		port, err := d.open(baud)
+		if err == nil {
+			d.ioMu.Lock()
+			d.port = port
+			d.rbuf = d.rbuf[:0]
+			d.ioMu.Unlock()
+		}
+
+		d.logf("reconnect attempt %v: %v", attempt, errString(err))
+		d.onReconnect(attempt, err)
+		if err == nil {
+			return nil
+		}
+
+		if err := sleepContext(ctx, backoff); err != nil {
+			return err
+		}
+		backoff *= 2
+		if backoff > reconnectMaxBackoff {
+			backoff = reconnectMaxBackoff
+		}
+	}
+}
+
+func errString(err error) string {
+	if err == nil {
+		return "ok"
+	}
+	return err.Error()
+}
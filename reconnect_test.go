@@ -0,0 +1,63 @@
+package sds011
+
+import (
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestListenReconnects(t *testing.T) {
+	defer func(min time.Duration) {
+		reconnectMinBackoff = min
+	}(reconnectMinBackoff)
+	reconnectMinBackoff = time.Millisecond
+
+	unplugged := errors.New("unplugged")
+	d := NewWithConn(&fakeConn{readErr: unplugged}, WithReadTimeout(100*time.Millisecond),
+		WithAutoReconnect(nil))
+
+	// The first attempt to reopen fails and the second succeeds.
+	var attempts []error
+	d.onReconnect = func(attempt int, err error) {
+		attempts = append(attempts, err)
+	}
+	opens := 0
+	d.open = func(int) (io.ReadWriteCloser, error) {
+		opens++
+		if opens == 1 {
+			return nil, unplugged
+		}
+		return &fakeConn{buf: queryResponse(50, 190)}, nil
+	}
+
+	var got Measurement
+	err := d.ListenE(func(m Measurement) error {
+		got = m
+		d.Stop()
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff(Measurement{PM25: 5, PM10: 19, DeviceID: 0xa160}, got, cmpFloats, ignoreTime); diff != "" {
+		t.Errorf("Unexpected result (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]error{unplugged, nil}, attempts, cmp.Comparer(func(x, y error) bool {
+		return x == y
+	})); diff != "" {
+		t.Errorf("Unexpected reconnect attempts (-want +got):\n%s", diff)
+	}
+}
+
+func TestListenWithoutReconnect(t *testing.T) {
+	unplugged := errors.New("unplugged")
+	d := newFakeDev(&fakeConn{readErr: unplugged})
+
+	if err := d.Listen(func(Measurement) {}); err != unplugged {
+		t.Errorf("got error %v, want %v", err, unplugged)
+	}
+}
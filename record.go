@@ -0,0 +1,65 @@
+package sds011
+
+import "io"
+
+// recordBufferSize is the number of packets queued for a Record writer before packets are dropped.
+const recordBufferSize = 64
+
+// recorder writes packets to a writer in the background so that a slow writer doesn't hold up reading.
+type recorder struct {
+	packets chan []byte
+	done    chan struct{}
+}
+
+func newRecorder(w io.Writer) *recorder {
+	r := &recorder{
+		packets: make(chan []byte, recordBufferSize),
+		done:    make(chan struct{}),
+	}
+
+	go func() {
+		defer close(r.done)
+		for p := range r.packets {
+			w.Write(p)
+		}
+	}()
+
+	return r
+}
+
+// record queues a copy of p to be written, dropping it if the queue is full.
+func (r *recorder) record(p []byte) {
+	select {
+	case r.packets <- append([]byte(nil), p...):
+	default:
+	}
+}
+
+// stop waits for queued packets to be written and then stops the recorder.
+func (r *recorder) stop() {
+	close(r.packets)
+	<-r.done
+}
+
+// Record writes every validated packet read from the sensor to w, verbatim, so that it can later be replayed
+// with NewReplay. Writing happens in the background so that a slow writer doesn't hold up reading: up to
+// recordBufferSize packets are queued, and packets that arrive while the queue is full are dropped. Write errors
+// are ignored.
+//
+// Calling Record again replaces the writer, and a nil w stops recording. Either way, and on Close, packets
+// already queued for the previous writer are written before Record returns.
+func (d *Dev) Record(w io.Writer) {
+	var r *recorder
+	if w != nil {
+		r = newRecorder(w)
+	}
+
+	d.mu.Lock()
+	old := d.rec
+	d.rec = r
+	d.mu.Unlock()
+
+	if old != nil {
+		old.stop()
+	}
+}
@@ -0,0 +1,57 @@
+package sds011
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRecord(t *testing.T) {
+	c := &fakeConn{
+		replies: [][]byte{
+			queryResponse(40, 180),
+			generalResponse(sleepWorkCommand, 0x01, 0x01),
+			queryResponse(50, 190),
+		},
+	}
+	d := newFakeDev(c)
+
+	var buf bytes.Buffer
+	d.Record(&buf)
+
+	var want []Measurement
+	for i := 0; i < 3; i++ {
+		if i == 1 {
+			if err := d.Wake(); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+
+		m, err := d.Sense()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, m)
+	}
+	d.Record(nil)
+
+	wantBytes := append(append(queryResponse(40, 180), generalResponse(sleepWorkCommand, 0x01, 0x01)...),
+		queryResponse(50, 190)...)
+	if diff := cmp.Diff(wantBytes, buf.Bytes()); diff != "" {
+		t.Errorf("Unexpected recording (-want +got):\n%s", diff)
+	}
+
+	// The recording replays to the same measurements.
+	r := NewReplay(&buf)
+	for _, w := range want {
+		got, err := r.Sense()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(w, got, cmpFloats, ignoreTime); diff != "" {
+			t.Errorf("Unexpected replayed measurement (-want +got):\n%s", diff)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package sds011
+
+import "io"
+
+// replayConn is a connection that reads from a recording and discards writes.
+type replayConn struct {
+	r io.Reader
+}
+
+func (c replayConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+func (c replayConn) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+// ResetInputBuffer does nothing. Nothing in a recording is stale, so flushing must not discard it.
+func (c replayConn) ResetInputBuffer() error {
+	return nil
+}
+
+func (c replayConn) Close() error {
+	if closer, ok := c.r.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// NewReplay returns a Dev that reads pre-recorded packets from r instead of a sensor, which is useful for
+// reproducing problems and for deterministic tests. r holds raw packets as read from the serial port, such as
+// those saved by Record. Commands sent to the Dev are discarded, and each command returns the next matching
+// packet from r. Once r is exhausted, reads return io.EOF: Sense returns it, and Listen stops and returns it.
+// If r is an io.Closer then Close closes it.
+func NewReplay(r io.Reader, opts ...Option) *Dev {
+	return NewWithConn(replayConn{r: r}, opts...)
+}
@@ -0,0 +1,51 @@
+package sds011
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestReplay(t *testing.T) {
+	var rec []byte
+	for i := uint16(1); i <= 3; i++ {
+		rec = append(rec, queryResponse(i*10, i*100)...)
+	}
+	d := NewReplay(bytes.NewReader(rec))
+
+	var got []Measurement
+	err := d.ListenE(func(m Measurement) error {
+		got = append(got, m)
+		return nil
+	})
+	if err != io.EOF {
+		t.Errorf("got error %v, want %v", err, io.EOF)
+	}
+
+	want := []Measurement{
+		{PM25: 1, PM10: 10, DeviceID: 0xa160},
+		{PM25: 2, PM10: 20, DeviceID: 0xa160},
+		{PM25: 3, PM10: 30, DeviceID: 0xa160},
+	}
+	if diff := cmp.Diff(want, got, cmpFloats, ignoreTime); diff != "" {
+		t.Errorf("Unexpected result (-want +got):\n%s", diff)
+	}
+}
+
+func TestReplaySense(t *testing.T) {
+	d := NewReplay(bytes.NewReader(queryResponse(50, 190)))
+
+	got, err := d.Sense()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(Measurement{PM25: 5, PM10: 19, DeviceID: 0xa160}, got, cmpFloats, ignoreTime); diff != "" {
+		t.Errorf("Unexpected result (-want +got):\n%s", diff)
+	}
+
+	if _, err := d.Sense(); err != io.EOF {
+		t.Errorf("got error %v, want %v", err, io.EOF)
+	}
+}
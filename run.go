@@ -0,0 +1,36 @@
+package sds011
+
+import "context"
+
+// Run is a complete listening loop for a long-running program. It wakes the sensor, puts it in ModeActive, and
+// passes measurements to h as Listen does until ctx is done or Stop is called, and then puts the sensor to sleep.
+// Drive ctx from the program's signals, such as with signal.NotifyContext, to shut down cleanly on SIGINT.
+//
+// Run returns nil when it's stopped by ctx or Stop, and otherwise the first error from setting up, listening, or
+// putting the sensor to sleep. It tries to put the sensor to sleep even if listening fails. It doesn't wait for
+// handlers still running in their own goroutines unless WithSynchronousHandler is used. The caller remains
+// responsible for closing the Dev.
+func (d *Dev) Run(ctx context.Context, h Handler) (err error) {
+	defer func() {
+		// ctx may be done, so put the sensor to sleep without it.
+		if sleepErr := d.Sleep(); sleepErr != nil && err == nil {
+			err = sleepErr
+		}
+	}()
+
+	if err := d.WakeContext(ctx); err != nil {
+		return ignoreDone(ctx, err)
+	}
+	if err := d.SetModeContext(ctx, ModeActive); err != nil {
+		return ignoreDone(ctx, err)
+	}
+	return ignoreDone(ctx, d.ListenContext(ctx, h))
+}
+
+// ignoreDone returns nil if err is due to ctx being done, and otherwise err.
+func ignoreDone(ctx context.Context, err error) error {
+	if err != nil && ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,57 @@
+package sds011
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	d := newTestSimulator()
+	if err := d.SetMode(ModeQuery); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Sleep(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	got := make(chan Measurement, 10)
+	errc := make(chan error)
+	go func() {
+		errc <- d.Run(ctx, func(m Measurement) {
+			select {
+			case got <- m:
+			default:
+			}
+		})
+	}()
+
+	// Run woke the sensor and switched it to ModeActive, so measurements arrive.
+	for i := 0; i < 3; i++ {
+		select {
+		case <-got:
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for measurement")
+		}
+	}
+
+	cancel()
+	select {
+	case err := <-errc:
+		if err != nil {
+			t.Errorf("Run returned error %v, want nil", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Run didn't return after ctx was cancelled")
+	}
+
+	if d.IsListening() {
+		t.Error("still listening after Run returned")
+	}
+	if working, err := d.GetSleepWorkState(); err != nil || working {
+		t.Errorf("GetSleepWorkState() = %v, %v, want false, nil", working, err)
+	}
+}
@@ -5,8 +5,12 @@ package sds011
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"io"
+	"math"
 	"strings"
 	"sync"
 	"time"
@@ -16,29 +20,305 @@ import (
 
 const (
 	packetLength = 10
+
+	// commandLength is the length of a command frame sent to the sensor.
+	commandLength = 19
+
+	// maxDataLength is the number of data bytes that follow the command ID in a command frame.
+	maxDataLength = 12
+
+	// MaxConcentration is the largest concentration, in μg/m³, that the sensor reports. The sensor reports this
+	// value when it's saturated, so a reading of MaxConcentration means "at least this much" rather than being
+	// a real concentration.
+	MaxConcentration float32 = 999.9
+
+	// BroadcastID is the device ID that addresses every sensor on the line. Commands sent to it are answered by
+	// every sensor, so if several share the line their responses collide.
+	BroadcastID uint16 = 0xffff
 )
 
+// Measurement is a reading from the sensor. Concentrations are in μg/m³, which is the only unit the sensor
+// reports, with a resolution of 0.1 μg/m³.
 type Measurement struct {
 	PM25 float32
 	PM10 float32
+
+	// DeviceID is the ID of the sensor that took the measurement.
+	DeviceID uint16
+
+	// Time is when the measurement was received from the sensor.
+	Time time.Time
+
+	// pm25Tenths and pm10Tenths are the concentrations in tenths of μg/m³ as sent by the sensor, if raw is set,
+	// which it is for measurements decoded from a packet.
+	pm25Tenths, pm10Tenths uint16
+	raw                    bool
+}
+
+// Valid reports whether both concentrations are within the sensor's output range of [0, MaxConcentration].
+// Values outside that range indicate a corrupt packet or a sensor fault.
+func (m Measurement) Valid() bool {
+	return m.PM25 >= 0 && m.PM25 <= MaxConcentration && m.PM10 >= 0 && m.PM10 <= MaxConcentration
+}
+
+// IsSaturated reports whether both concentrations are at the top of the sensor's range. The sensor reports this
+// when its inlet is blocked or it's otherwise faulty, but very heavy pollution, such as wildfire smoke close by,
+// can cause it too.
+func (m Measurement) IsSaturated() bool {
+	return m.PM25 >= MaxConcentration && m.PM10 >= MaxConcentration
+}
+
+// Equal reports whether m and other have the same device ID and concentrations that differ by no more than
+// epsilon μg/m³. Time is ignored, so repeated readings of the same air compare equal.
+func (m Measurement) Equal(other Measurement, epsilon float32) bool {
+	return m.DeviceID == other.DeviceID && abs32(m.PM25-other.PM25) <= epsilon && abs32(m.PM10-other.PM10) <= epsilon
+}
+
+// Delta returns m with other's concentrations subtracted from its own, so positive values mean m is higher.
+func (m Measurement) Delta(other Measurement) Measurement {
+	m.PM25 -= other.PM25
+	m.PM10 -= other.PM10
+	return m
+}
+
+// PM25Float64 returns the PM2.5 concentration as a float64. For a measurement read from the sensor or decoded with
+// DecodePacket, it's the raw value that the sensor sent, unless PM25 has been changed since, so a reading of 18.4
+// is 18.4 rather than the 18.399999618530273 that converting the float32 gives. Otherwise it's PM25 converted
+// as is, since a computed value such as an average isn't limited to the sensor's resolution of 0.1 μg/m³.
+func (m Measurement) PM25Float64() float64 {
+	if m.raw && float32(m.pm25Tenths)/10 == m.PM25 {
+		return float64(m.pm25Tenths) / 10
+	}
+	return float64(m.PM25)
+}
+
+// PM10Float64 returns the PM10 concentration as a float64, like PM25Float64.
+func (m Measurement) PM10Float64() float64 {
+	if m.raw && float32(m.pm10Tenths)/10 == m.PM10 {
+		return float64(m.pm10Tenths) / 10
+	}
+	return float64(m.PM10)
+}
+
+// Float64s returns the PM2.5 and PM10 concentrations, in that order, as float64s like PM25Float64.
+func (m Measurement) Float64s() [2]float64 {
+	return [2]float64{m.PM25Float64(), m.PM10Float64()}
+}
+
+// PM25Tenths returns the PM2.5 concentration as an integer number of tenths of μg/m³, which is how the sensor
+// reports it. Integers avoid floating-point representation error, so they're better for exact comparison,
+// bucketing, and storage. For a measurement read from the sensor or decoded with DecodePacket, it's the raw value
+// that the sensor sent, unless PM25 has been changed since. Otherwise it's PM25 rounded to the nearest tenth,
+// which for a measurement decoded from JSON or binary is also exactly the value the sensor sent. Concentrations
+// outside the range of a uint16 are clamped.
+func (m Measurement) PM25Tenths() uint16 {
+	if m.raw && float32(m.pm25Tenths)/10 == m.PM25 {
+		return m.pm25Tenths
+	}
+	return toTenths(m.PM25)
+}
+
+// PM10Tenths returns the PM10 concentration as an integer number of tenths of μg/m³, like PM25Tenths.
+func (m Measurement) PM10Tenths() uint16 {
+	if m.raw && float32(m.pm10Tenths)/10 == m.PM10 {
+		return m.pm10Tenths
+	}
+	return toTenths(m.PM10)
+}
+
+func toTenths(v float32) uint16 {
+	t := math.Round(float64(v) * 10)
+	if t <= 0 {
+		return 0
+	}
+	if t >= math.MaxUint16 {
+		return math.MaxUint16
+	}
+	return uint16(t)
+}
+
+func abs32(v float32) float32 {
+	if v < 0 {
+		return -v
+	}
+	return v
 }
 
 func (m Measurement) String() string {
-	return fmt.Sprintf("PM2.5 = %v μg/m³  PM10 = %v μg/m³", m.PM25, m.PM10)
+	s := fmt.Sprintf("PM2.5 = %v μg/m³  PM10 = %v μg/m³", m.PM25, m.PM10)
+	if m.Time.IsZero() {
+		return s
+	}
+	return m.Time.Format(time.RFC3339) + "  " + s
+}
+
+// Format implements fmt.Formatter. The %v and %s verbs give the same result as String. The + flag, as in %+v,
+// adds the device ID and gives the time to full precision. A width or precision is applied to each concentration,
+// so that measurements line up in columns: %6.1v pads each to six characters with one decimal place. If only a
+// width is given then the precision is 1, the sensor's resolution, and the - flag pads on the right instead.
+func (m Measurement) Format(f fmt.State, verb rune) {
+	switch verb {
+	case 'v', 's':
+	default:
+		fmt.Fprintf(f, "%%!%c(sds011.Measurement=%s)", verb, m.String())
+		return
+	}
+
+	width, hasWidth := f.Width()
+	prec, hasPrec := f.Precision()
+	if !hasWidth && !hasPrec && !f.Flag('+') {
+		io.WriteString(f, m.String())
+		return
+	}
+
+	conc := func(v float32) string {
+		if !hasWidth && !hasPrec {
+			return fmt.Sprint(v)
+		}
+		if !hasPrec {
+			prec = 1
+		}
+		if f.Flag('-') {
+			return fmt.Sprintf("%-*.*f", width, prec, v)
+		}
+		return fmt.Sprintf("%*.*f", width, prec, v)
+	}
+
+	s := fmt.Sprintf("PM2.5 = %s μg/m³  PM10 = %s μg/m³", conc(m.PM25), conc(m.PM10))
+	layout := time.RFC3339
+	if f.Flag('+') {
+		s += fmt.Sprintf("  id=0x%04x", m.DeviceID)
+		layout = time.RFC3339Nano
+	}
+	if !m.Time.IsZero() {
+		s = m.Time.Format(layout) + "  " + s
+	}
+	io.WriteString(f, s)
+}
+
+// FirmwareVersion is the sensor's firmware version, which is the date the firmware was built.
+type FirmwareVersion struct {
+	// Year is the last two digits of the year.
+	Year  int
+	Month int
+	Day   int
+}
+
+func (v FirmwareVersion) String() string {
+	return fmt.Sprintf("%02d-%02d-%02d", v.Year, v.Month, v.Day)
+}
+
+// Bytes returns the version as the three raw bytes (year, month, day) sent by the sensor.
+func (v FirmwareVersion) Bytes() []byte {
+	return []byte{byte(v.Year), byte(v.Month), byte(v.Day)}
 }
 
+// Dev is an SDS011 sensor. Its methods are safe for concurrent use: commands, including reads by a running Listen
+// loop, are serialized, so each command blocks until the one before it has completed. A Dev holds locks and the
+// state of the connection, so it must not be copied; use the *Dev returned by New. go vet reports copies.
 type Dev struct {
-	port       *serial.Port
+	// name is the name of the serial port, or empty if the Dev wasn't created by New.
+	name string
+
+	port       io.ReadWriteCloser
 	id         uint16
 	stopListen bool
 
-	// readTimeout is the timeout used in readAndValidate.
+	// readTimeout is the timeout used in readAndValidate. Guarded by ioMu.
 	readTimeout time.Duration
 
+	// ioMu serializes use of the port, so that one command's write and read aren't interleaved with another's.
+	// It guards port, id, readTimeout, rbuf, and packet.
+	ioMu sync.Mutex
+
+	// cfgMu also guards id and readTimeout, which are written with both it and ioMu held, so that String and
+	// ReadTimeout can read them without waiting for a command in progress.
+	cfgMu sync.Mutex
+
+	// checkRange is whether sense rejects measurements that aren't Valid.
+	checkRange bool
+
+	// checkID is whether sense rejects measurements whose device ID differs from the last accepted one, which is
+	// lastID if haveLastID is set. newID is a different ID that the last newIDCount measurements agreed on. Guarded
+	// by mu.
+	checkID    bool
+	lastID     uint16
+	haveLastID bool
+	newID      uint16
+	newIDCount int
+
+	// checkSaturation is whether sense reports saturated measurements as errors.
+	checkSaturation bool
+
+	// keepAwake is whether SampleEvery leaves the sensor awake between samples, and Close puts it to sleep.
+	keepAwake bool
+
+	// awake is whether the sensor was last known to be awake, if awakeKnown is set. Guarded by mu.
+	awake      bool
+	awakeKnown bool
+
+	// debug, if non-nil, receives a log of every frame written and packet read. Guarded by mu.
+	debug io.Writer
+
+	// logger receives diagnostics such as retries and discarded packets.
+	logger Logger
+
+	// open reopens the serial port at the given baud rate. It's nil if the Dev wasn't created by New.
+	open func(baud int) (io.ReadWriteCloser, error)
+
+	// baudRate is the baud rate of the serial port. Guarded by ioMu.
+	baudRate int
+
+	// onReconnect, if non-nil, enables reconnecting after port errors while listening and is called after each
+	// attempt.
+	onReconnect func(attempt int, err error)
+
+	// retries is how many times a command is re-sent after its response times out, waiting retryBackoff before
+	// each retry.
+	retries      int
+	retryBackoff time.Duration
+
+	// handlerSem, if non-nil, limits how many handlers started by Listen run at once. If dropHandlers is true then
+	// measurements that arrive while it's full are dropped rather than waiting for a handler to return.
+	handlerSem   chan struct{}
+	dropHandlers bool
+
+	// syncHandlers makes Listen call handlers inline rather than in their own goroutines.
+	syncHandlers bool
+
+	// rec, if non-nil, receives every validated packet. Guarded by mu.
+	rec *recorder
+
+	// lastPacket is the last validated packet, or empty if there hasn't been one. Guarded by mu.
+	lastPacket []byte
+
+	// rbuf holds bytes read from the port that aren't yet part of a complete packet. It never holds more than a
+	// packet's worth, so once allocated it's reused.
+	rbuf []byte
+
+	// packet holds the packet most recently returned by read, so that reading doesn't allocate.
+	packet []byte
+
+	// packetLen is the length of the packets the sensor sends.
+	packetLen int
+
 	mu       sync.Mutex
 	doneChan chan struct{}
+
+	// listenDone is closed when the active Listen loop returns.
+	listenDone chan struct{}
+	closed     bool
+
+	// subMu guards the subscribers to the shared read loop started by Subscribe. subCancel stops the loop, and
+	// subDone is closed once it has returned; both are nil if it isn't running.
+	subMu     sync.Mutex
+	subs      map[chan Measurement]struct{}
+	subCancel context.CancelFunc
+	subDone   chan struct{}
 }
 
+var _ io.Closer = (*Dev)(nil)
+
 type Mode byte
 
 type command byte
@@ -62,269 +342,1539 @@ var (
 	head byte = 0xaa
 	tail byte = 0xab
 
-	errTimeout = fmt.Errorf("sds011: read timeout")
+	defaultTimeout         = 2 * time.Second
+	defaultBaudRate        = 9600
+	defaultPortReadTimeout = 250 * time.Millisecond
 
-	defaultTimeout = 2 * time.Second
-)
+	// orderedBufferSize is the number of measurements ListenOrdered queues for its handler.
+	orderedBufferSize = 16
 
-type Handler func(Measurement)
+	debugTimeFormat = "2006-01-02T15:04:05.000Z07:00"
 
-func New(name string) (Dev, error) {
-	port, err := serial.Open(name, serial.WithBaudrate(9600), serial.WithDataBits(8),
-		serial.WithParity(serial.NoParity), serial.WithStopBits(serial.OneStopBit))
-	if err != nil {
-		return Dev{}, err
-	}
+	// streamBufferSize is the number of measurements Stream buffers for its consumer.
+	streamBufferSize = 16
 
-	// Without a timeout Read returns immediately.
-	port.SetReadTimeout(250)
+	// idRelatchCount is the number of consecutive measurements that must agree on a new device ID for WithStrictCheck
+	// to accept it, in case the ID it was expecting came from a corrupt packet.
+	idRelatchCount = 3
+)
 
-	return Dev{
-		port:        port,
-		id:          0xffff,
-		readTimeout: defaultTimeout,
-	}, nil
+// Sensor is the set of operations that programs commonly use to take measurements. *Dev implements it, and code
+// that accepts a Sensor rather than a *Dev can be tested with a fake.
+type Sensor interface {
+	Sense() (Measurement, error)
+	Listen(h Handler) error
+	Stop()
+	SetMode(m Mode) error
+	SetPeriod(minutes int) error
+	Sleep() error
+	Wake() error
+	GetFirmwareVersion() (FirmwareVersion, error)
+	Close() error
 }
 
-func (d *Dev) sense() (Measurement, error) {
-	buf, err := d.readAndValidate(cmdTypeQuery, queryCommand)
-	if err != nil {
-		return Measurement{}, err
-	}
-	return unmarshal(buf)
-}
+var _ Sensor = (*Dev)(nil)
 
-func (d *Dev) Sense() (Measurement, error) {
-	cmd := []byte{byte(queryCommand)}
-	if err := d.write(cmd); err != nil {
-		return Measurement{}, err
-	}
+// Errors returned by this package. Errors that carry more detail wrap one of these, so check for them with errors.Is.
+var (
+	ErrTimeout          = errors.New("sds011: read timeout")
+	ErrClosed           = errors.New("sds011: already closed")
+	ErrAlreadyListening = errors.New("sds011: already listening")
+	ErrBadLength        = errors.New("sds011: bad packet length")
+	ErrBadHeader        = errors.New("sds011: bad header")
+	ErrBadTail          = errors.New("sds011: bad tail")
+	ErrBadCommandType   = errors.New("sds011: incorrect command type")
+	ErrBadCommandID     = errors.New("sds011: incorrect command ID")
+	ErrBadChecksum      = errors.New("sds011: bad checksum")
+	ErrOutOfRange       = errors.New("sds011: measurement out of range")
+	ErrDeviceIDChanged  = errors.New("sds011: device ID changed")
+	ErrSaturated        = errors.New("sds011: measurement saturated")
+	ErrBadEcho          = errors.New("sds011: response doesn't match setting")
+	ErrNotSDS011        = errors.New("sds011: device didn't respond as an SDS011")
+	ErrNotStable        = errors.New("sds011: readings didn't stabilize")
+	ErrUnsupported      = errors.New("sds011: not supported by the sensor")
+	ErrNotFound         = errors.New("sds011: no sensor found")
+)
 
-	return d.sense()
+// Logger receives diagnostic messages. *log.Logger implements it.
+type Logger interface {
+	Printf(format string, v ...interface{})
 }
 
-func (d *Dev) Listen(h Handler) error {
-	d.mu.Lock()
-	if d.doneChan != nil {
-		d.mu.Unlock()
-		return fmt.Errorf("sds011: already listening")
-	}
+type nopLogger struct{}
 
-	d.doneChan = make(chan struct{})
-	d.mu.Unlock()
+func (nopLogger) Printf(format string, v ...interface{}) {}
 
-	for {
-		select {
-		case <-d.doneChan:
-			d.mu.Lock()
-			defer d.mu.Unlock()
+type Handler func(Measurement)
 
-			// Reset the channel so Listen can be called again.
-			d.doneChan = nil
-			return nil
-		default:
-		}
+// HandlerE is like Handler but may return an error to stop listening.
+type HandlerE func(Measurement) error
+
+// Option configures a Dev created by New.
+type Option func(*options)
+
+type options struct {
+	baudRate        int
+	readTimeout     time.Duration
+	portReadTimeout time.Duration
+	checkRange      bool
+	checkID         bool
+	checkSaturation bool
+	keepAwake       bool
+	debug           io.Writer
+	logger          Logger
+	onReconnect     func(attempt int, err error)
+	retries         int
+	retryBackoff    time.Duration
+	probe           bool
+	maxHandlers     int
+	dropHandlers    bool
+	syncHandlers    bool
+	packetLen       int
+}
 
-		m, err := d.sense()
-		if err == errTimeout {
-			continue
-		} else if err != nil {
-			return err
+// WithBaudRate sets the baud rate of the serial port. The default is 9600.
+func WithBaudRate(baud int) Option {
+	return func(o *options) {
+		o.baudRate = baud
+	}
+}
+
+// WithReadTimeout sets how long to wait for a valid response to a command. The default is 2 seconds. Durations
+// that aren't positive are ignored, since every command would time out at once.
+func WithReadTimeout(t time.Duration) Option {
+	return func(o *options) {
+		if t > 0 {
+			o.readTimeout = t
 		}
-		go h(m)
 	}
 }
 
-func (d *Dev) Stop() {
-	d.mu.Lock()
-	defer d.mu.Unlock()
+// WithPortReadTimeout sets the timeout of a single read from the serial port. The default is 250 milliseconds.
+// Durations that aren't positive are ignored, since without a timeout reads return immediately and reading would
+// spin.
+func WithPortReadTimeout(t time.Duration) Option {
+	return func(o *options) {
+		if t > 0 {
+			o.portReadTimeout = t
+		}
+	}
+}
 
-	// If the channel is nil then we're not currently listening.
-	if d.doneChan == nil {
-		return
+// WithRangeCheck makes measurements that aren't Valid an error wrapping ErrOutOfRange. This catches corrupt
+// packets whose checksum happens to match.
+func WithRangeCheck() Option {
+	return func(o *options) {
+		o.checkRange = true
 	}
+}
 
-	select {
-	case <-d.doneChan:
-		// Already closed. Don't close again.
-	default:
-		// Safe to close. We're the only closer, guarded by d.mu.
-		close(d.doneChan)
+// WithRetries makes commands re-send up to n times if the sensor doesn't respond within the read timeout, waiting
+// backoff before each retry. The sensor occasionally misses a command, so re-sending rather than only waiting
+// longer lets it try again. By default commands aren't retried. Sense is retried too, but measurements read by
+// Listen aren't.
+func WithRetries(n int, backoff time.Duration) Option {
+	return func(o *options) {
+		o.retries = n
+		o.retryBackoff = backoff
 	}
 }
 
-func (d *Dev) SetMode(m Mode) error {
-	cmd := []byte{byte(modeCommand), 0x01, byte(m)}
-	if err := d.write(cmd); err != nil {
-		return err
+// WithMaxHandlerGoroutines limits the number of goroutines that Listen runs handlers in to n, so that a handler
+// that stalls doesn't accumulate goroutines without bound. When n handlers are running, Listen either waits for
+// one to return before reading further or, if drop is true, drops the measurement, logging that it did. While
+// Listen waits, the sensor's measurements are buffered by the serial port, which may overflow and lose some. By
+// default the number of handler goroutines isn't limited.
+func WithMaxHandlerGoroutines(n int, drop bool) Option {
+	return func(o *options) {
+		o.maxHandlers = n
+		o.dropHandlers = drop
 	}
+}
 
-	_, err := d.readAndValidate(cmdTypeGeneral, modeCommand)
-	return err
+// WithSynchronousHandler makes Listen and ListenContext call the handler inline, so measurements are handled one
+// at a time in the order they arrived and Listen doesn't read the next one until the handler returns. That makes
+// behavior deterministic, which is useful in tests, but a slow handler holds up reading, and measurements sent in
+// the meantime are buffered by the serial port, which may overflow and lose some. WithMaxHandlerGoroutines has no
+// effect with this option.
+func WithSynchronousHandler() Option {
+	return func(o *options) {
+		o.syncHandlers = true
+	}
 }
 
-func (d *Dev) SetDeviceID(id uint16) error {
-	cmd := make([]byte, 11)
-	cmd[0] = byte(deviceIDCommand)
-	cmd = append(cmd, toBytes(id)...)
-	if err := d.write(cmd); err != nil {
-		return err
+// WithPacketLength sets the length of the packets that the sensor sends, for clones that send an extended frame of
+// n bytes rather than the standard 10. That's the only variant supported: the standard frame with n-10 extra bytes
+// after the device ID, so that bytes 0–7 are as in a standard packet and the last two are the checksum and tail.
+// The checksum covers every byte from the third up to it, extra bytes included. For example, a 12-byte frame is
+//
+//	AA C0 PM25_LO PM25_HI PM10_LO PM10_HI ID_HI ID_LO X1 X2 CHECKSUM AB
+//
+// Every packet must then be n bytes, responses to commands included, and standard packets are rejected.
+// DecodePacket is unaffected and accepts only standard packets. WithPacketLength panics if n is less than 10.
+func WithPacketLength(n int) Option {
+	if n < packetLength {
+		panic(fmt.Sprintf("sds011: packet length must be at least %v, got %v", packetLength, n))
 	}
 
-	_, err := d.readAndValidate(cmdTypeGeneral, deviceIDCommand)
-	return err
+	return func(o *options) {
+		o.packetLen = n
+	}
 }
 
-func (d *Dev) sleepWake(sw byte) error {
-	cmd := []byte{byte(sleepWorkCommand), 0x01, sw}
-	if err := d.write(cmd); err != nil {
-		return err
+// WithStrictCheck rejects measurements that are likely to come from packets corrupted in a way that the checksum
+// doesn't catch. It implies WithRangeCheck, and additionally makes a measurement whose device ID differs from that
+// of the previous measurement an error wrapping ErrDeviceIDChanged. SetDeviceID resets the expected ID, and so do
+// 3 consecutive measurements with the same new ID, in case the expected ID came from a corrupt packet.
+func WithStrictCheck() Option {
+	return func(o *options) {
+		o.checkRange = true
+		o.checkID = true
 	}
-
-	_, err := d.readAndValidate(cmdTypeGeneral, sleepWorkCommand)
-	return err
 }
 
-func (d *Dev) Sleep() error {
-	return d.sleepWake(0x00)
+// WithSaturationCheck makes Sense return an error wrapping ErrSaturated, along with the measurement, if the
+// measurement IsSaturated. This lets callers tell a likely fault from a genuine reading, but since very high
+// pollution can saturate the sensor too it's up to them whether to discard the measurement. Listen discards it.
+func WithSaturationCheck() Option {
+	return func(o *options) {
+		o.checkSaturation = true
+	}
 }
 
-func (d *Dev) Wake() error {
-	return d.sleepWake(0x01)
+// WithKeepAwake makes SampleEvery leave the sensor awake between samples rather than putting it to sleep and
+// warming it up again for each one, which is quicker when sampling often. Close then puts the sensor to sleep
+// unless it's already known to be asleep.
+func WithKeepAwake() Option {
+	return func(o *options) {
+		o.keepAwake = true
+	}
 }
 
-func (d *Dev) SetPeriod(minutes int) error {
-	if minutes < 0 || minutes > 30 {
-		return fmt.Errorf("sds011: working period must be in [0, 30]")
+// WithLogger logs diagnostics to l: commands that time out or are retried, bytes discarded to resynchronize with
+// the packet framing, packets discarded because they're invalid or from another device, and reconnection
+// attempts. These are also written to the debug writer, if there is one. By default diagnostics aren't logged.
+func WithLogger(l Logger) Option {
+	return func(o *options) {
+		o.logger = l
 	}
+}
 
-	cmd := []byte{byte(workingPeriodCommand), 0x01, byte(minutes)}
-	if err := d.write(cmd); err != nil {
-		return err
+// WithProbe makes New check that the device on the port is an SDS011 with Ping, which works whether the sensor is
+// awake or asleep. If the device doesn't respond then New closes the port and returns an error wrapping
+// ErrNotSDS011, which usually means that the wrong port was given. By default New doesn't probe.
+func WithProbe() Option {
+	return func(o *options) {
+		o.probe = true
 	}
+}
 
-	_, err := d.readAndValidate(cmdTypeGeneral, workingPeriodCommand)
-	return err
+// WithDebugWriter logs raw serial traffic to w. See SetDebugWriter.
+func WithDebugWriter(w io.Writer) Option {
+	return func(o *options) {
+		o.debug = w
+	}
 }
 
-func (d *Dev) GetFirmwareVersion() ([]byte, error) {
-	cmd := []byte{byte(firmwareVersionCommand)}
-	if err := d.write(cmd); err != nil {
-		return []byte{}, err
+func New(name string, opts ...Option) (*Dev, error) {
+	o := options{
+		baudRate:        defaultBaudRate,
+		readTimeout:     defaultTimeout,
+		portReadTimeout: defaultPortReadTimeout,
+	}
+	for _, opt := range opts {
+		opt(&o)
 	}
 
-	b, err := d.readAndValidate(cmdTypeGeneral, firmwareVersionCommand)
+	port, err := openPort(name, o)
 	if err != nil {
 		return nil, err
 	}
-	return b[3:6], nil
+
+	d := newDev(name, port, o)
+	if o.probe {
+		if err := d.probe(); err != nil {
+			port.Close()
+			return nil, err
+		}
+	}
+	return d, nil
+}
+
+// probe checks that the device responds to a command the way an SDS011 does.
+func (d *Dev) probe() error {
+	if err := d.Ping(); err != nil {
+		return &notSDS011Error{name: d.name, err: err}
+	}
+	return nil
+}
+
+// notSDS011Error is returned by probe. It matches ErrNotSDS011 with errors.Is, and wraps the error that the probe
+// failed with so that that can be checked too.
+type notSDS011Error struct {
+	name string
+	err  error
 }
 
-func (d *Dev) write(b []byte) error {
-	data := make([]byte, 13)
-	copy(data, b)
+func (e *notSDS011Error) Error() string {
+	return fmt.Sprintf("%v: device at %s: %v", ErrNotSDS011, e.name, e.err)
+}
 
-	var buf bytes.Buffer
-	buf.Write([]byte{head, 0xb4})
-	buf.Write(data)
-	buf.Write(toBytes(d.id))
-	buf.WriteByte(checksum(append(data, toBytes(d.id)...)))
-	buf.WriteByte(tail)
+func (e *notSDS011Error) Is(target error) bool {
+	return target == ErrNotSDS011
+}
 
-	_, err := d.port.Write(buf.Bytes())
-	return err
+func (e *notSDS011Error) Unwrap() error {
+	return e.err
 }
 
-func (d *Dev) read() ([]byte, error) {
-	packet := make([]byte, packetLength)
-	n, err := d.port.Read(packet)
+func openPort(name string, o options) (*serial.Port, error) {
+	port, err := serial.Open(name, serial.WithBaudrate(o.baudRate), serial.WithDataBits(8),
+		serial.WithParity(serial.NoParity), serial.WithStopBits(serial.OneStopBit))
 	if err != nil {
 		return nil, err
 	}
-	if n != packetLength {
-		return nil, fmt.Errorf("sds011: read: bad packet length, got %v, expected %v", n, packetLength)
-	}
 
-	// Do just enough validation to determine that the structure of the packet is valid.
-	if packet[0] != head {
-		return nil, fmt.Errorf("sds011: bad header")
+	// Without a timeout Read returns immediately.
+	if err := port.SetReadTimeout(int(o.portReadTimeout / time.Millisecond)); err != nil {
+		port.Close()
+		return nil, err
 	}
-	if !contains([]byte{byte(cmdTypeQuery), byte(cmdTypeGeneral)}, packet[1]) {
-		return nil, fmt.Errorf("sds011: bad command type")
+
+	return port, nil
+}
+
+// NewWithConn returns a Dev that talks to the sensor over conn instead of opening a serial port.
+// This is primarily useful for testing against a fake connection. WithBaudRate and WithPortReadTimeout
+// have no effect; conn's Read should return (0, nil) or an error rather than block indefinitely.
+func NewWithConn(conn io.ReadWriteCloser, opts ...Option) *Dev {
+	o := options{
+		readTimeout: defaultTimeout,
 	}
-	if packet[packetLength-1] != tail {
-		return nil, fmt.Errorf("sds011: bad tail")
+	for _, opt := range opts {
+		opt(&o)
 	}
 
-	return packet, nil
+	return newDev("", conn, o)
 }
 
-func (d *Dev) readAndValidate(typ commandType, cmd command) ([]byte, error) {
-	start := time.Now()
+// newDev returns a Dev using conn. If name is non-empty then conn is the serial port with that name, which the Dev
+// can reopen.
+func newDev(name string, conn io.ReadWriteCloser, o options) *Dev {
+	if o.logger == nil {
+		o.logger = nopLogger{}
+	}
 
-	b, err := d.read()
-	for err != nil || validate(b, typ, cmd) != nil {
-		if time.Now().Sub(start) > d.readTimeout {
-			return b, errTimeout
+	if o.packetLen == 0 {
+		o.packetLen = packetLength
+	}
+
+	var handlerSem chan struct{}
+	if o.maxHandlers > 0 {
+		handlerSem = make(chan struct{}, o.maxHandlers)
+	}
+
+	var open func(baud int) (io.ReadWriteCloser, error)
+	if name != "" {
+		open = func(baud int) (io.ReadWriteCloser, error) {
+			o := o
+			o.baudRate = baud
+			return openPort(name, o)
 		}
+	}
 
-		b, err = d.read()
+	return &Dev{
+		name:            name,
+		port:            conn,
+		open:            open,
+		baudRate:        o.baudRate,
+		id:              BroadcastID,
+		readTimeout:     o.readTimeout,
+		checkRange:      o.checkRange,
+		checkID:         o.checkID,
+		checkSaturation: o.checkSaturation,
+		keepAwake:       o.keepAwake,
+		debug:           o.debug,
+		logger:          o.logger,
+		onReconnect:     o.onReconnect,
+		retries:         o.retries,
+		retryBackoff:    o.retryBackoff,
+		handlerSem:      handlerSem,
+		dropHandlers:    o.dropHandlers,
+		syncHandlers:    o.syncHandlers,
+		packetLen:       o.packetLen,
+		packet:          make([]byte, o.packetLen),
 	}
-	return b, err
 }
 
-func unmarshal(b []byte) (Measurement, error) {
-	if len(b) != packetLength {
-		return Measurement{}, fmt.Errorf("sds011: bad packet length, got %v, expected %v", len(b), packetLength)
+// sense reads a measurement sent by the sensor in active mode. It makes a single attempt, returning ErrTimeout if
+// the next packet read from the port isn't a measurement, so that callers holding d.ioMu don't hold it for long.
+func (d *Dev) sense(ctx context.Context) (Measurement, error) {
+	buf, err := d.readAndValidateFrom(ctx, cmdTypeQuery, queryCommand, d.id, 0)
+	if err != nil {
+		return Measurement{}, err
 	}
 
-	return Measurement{
-		PM25: float32(binary.LittleEndian.Uint16(b[2:4])) / 10,
-		PM10: float32(binary.LittleEndian.Uint16(b[4:6])) / 10,
-	}, nil
+	return d.measurement(buf)
 }
 
-func validate(b []byte, typ commandType, cmd command) error {
-	if len(b) != packetLength {
-		return fmt.Errorf("sds011: validate: bad packet length, got %v, expected %v", len(b), packetLength)
+// measurement decodes a validated query response packet.
+func (d *Dev) measurement(buf []byte) (Measurement, error) {
+	m, err := unmarshal(buf)
+	if err != nil {
+		return Measurement{}, err
 	}
-
-	if b[0] != head {
-		return fmt.Errorf("sds011: bad header")
+	if d.checkRange && !m.Valid() {
+		return Measurement{}, fmt.Errorf("%w: %v", ErrOutOfRange, m)
 	}
-	if b[1] != byte(typ) {
-		return fmt.Errorf("sds011: incorrect command type, got 0x%x, want 0x%x", b[1], byte(typ))
+	if err := d.checkDeviceID(m.DeviceID); err != nil {
+		return Measurement{}, err
 	}
+	m.Time = time.Now()
+	if d.checkSaturation && m.IsSaturated() {
+		return m, fmt.Errorf("%w: %v", ErrSaturated, m)
+	}
+	return m, nil
+}
 
-	// Query responses don't include the command byte because all the space is taken up by the measurement data.
-	if typ != cmdTypeQuery && b[2] != byte(cmd) {
-		return fmt.Errorf("sds011: incorrect command ID, got 0x%x, want 0x%x", b[2], byte(cmd))
+// Name returns the name of the serial port passed to New, or an empty string if the Dev wasn't created by New.
+func (d *Dev) Name() string {
+	return d.name
+}
+
+// String describes the Dev without communicating with the sensor, for example "sds011 /dev/ttyUSB0 id=0xffff
+// timeout=2s". The port name is omitted if the Dev wasn't created by New.
+func (d *Dev) String() string {
+	d.cfgMu.Lock()
+	defer d.cfgMu.Unlock()
+
+	s := "sds011"
+	if d.name != "" {
+		s += " " + d.name
 	}
+	return fmt.Sprintf("%s id=0x%04x timeout=%v", s, d.id, d.readTimeout)
+}
+
+// rejected reports whether err is from a measurement that was read successfully but rejected by one of the checks
+// enabled by options.
+func rejected(err error) bool {
+	return errors.Is(err, ErrOutOfRange) || errors.Is(err, ErrDeviceIDChanged) || errors.Is(err, ErrSaturated)
+}
 
-	if b[9] != tail {
-		return fmt.Errorf("sds011: bad tail")
+// checkDeviceID returns an error wrapping ErrDeviceIDChanged if strict checking is on and id differs from the ID
+// of the last measurement that passed the check, unless it's the idRelatchCount'th consecutive measurement with
+// that ID, in which case it becomes the expected ID.
+func (d *Dev) checkDeviceID(id uint16) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if !d.checkID {
+		return nil
+	}
+	if d.haveLastID && id != d.lastID {
+		if id == d.newID && d.newIDCount > 0 {
+			d.newIDCount++
+		} else {
+			d.newID = id
+			d.newIDCount = 1
+		}
+		if d.newIDCount < idRelatchCount {
+			return fmt.Errorf("%w, got 0x%04x, expected 0x%04x", ErrDeviceIDChanged, id, d.lastID)
+		}
 	}
+	d.lastID = id
+	d.haveLastID = true
+	d.newIDCount = 0
+	return nil
+}
+
+func (d *Dev) Sense() (Measurement, error) {
+	return d.SenseContext(context.Background())
+}
 
-	if b[8] != checksum(b[2:8]) {
-		return fmt.Errorf("sds011: bad checksum")
+// SenseContext is like Sense but stops waiting for the response and returns ctx.Err() if ctx is done.
+func (d *Dev) SenseContext(ctx context.Context) (Measurement, error) {
+	buf, err := d.command(ctx, queryCommand)
+	if err != nil {
+		return Measurement{}, err
 	}
 
-	return nil
+	return d.measurement(buf)
 }
 
-func checksum(b []byte) byte {
-	var sum int
-	for _, v := range b {
-		sum += int(v)
+// WaitForData waits up to timeout for the sensor to send a measurement in active mode, and returns it. It doesn't
+// send any commands, and it reads only up to the end of that measurement, so it's a way to check that data is
+// flowing before listening. It returns ErrTimeout if no measurement arrives, and ErrAlreadyListening if a Listen
+// loop is running, since the two would compete for measurements.
+func (d *Dev) WaitForData(timeout time.Duration) (Measurement, error) {
+	if d.IsListening() {
+		return Measurement{}, ErrAlreadyListening
 	}
 
-	return byte(sum & 0xff)
+	d.ioMu.Lock()
+	defer d.ioMu.Unlock()
+
+	buf, err := d.readAndValidateFrom(context.Background(), cmdTypeQuery, queryCommand, d.id, timeout)
+	if err != nil {
+		return Measurement{}, err
+	}
+	return d.measurement(buf)
 }
 
-func toBytes(u uint16) []byte {
-	b := make([]byte, 2)
-	binary.BigEndian.PutUint16(b, u)
-	return b
+// Listen reads the measurements that the sensor sends in active mode and passes each to h, until Stop is called or
+// a read fails (see WithAutoReconnect). By default each call to h runs in its own goroutine, so a slow handler
+// doesn't hold up reading, but handlers may run concurrently and finish out of order; WithMaxHandlerGoroutines
+// limits how many run at once. With WithSynchronousHandler, h is instead called inline, one measurement at a time
+// in order. Measurements that fail the checks enabled by options, and reads that time out, are skipped.
+func (d *Dev) Listen(h Handler) error {
+	return d.ListenContext(context.Background(), h)
+}
+
+// ListenContext is like Listen but also returns when ctx is done, in which case it returns ctx.Err().
+// Stop may still be used to end the loop, in which case ListenContext returns nil.
+func (d *Dev) ListenContext(ctx context.Context, h Handler) error {
+	return d.listen(ctx, func(m Measurement) error {
+		if d.syncHandlers {
+			h(m)
+			return nil
+		}
+		if d.handlerSem == nil {
+			go h(m)
+			return nil
+		}
+
+		if d.dropHandlers {
+			select {
+			case d.handlerSem <- struct{}{}:
+			default:
+				d.logf("dropped measurement: %v handlers already running", cap(d.handlerSem))
+				return nil
+			}
+		} else {
+			d.mu.Lock()
+			done := d.doneChan
+			d.mu.Unlock()
+
+			select {
+			case d.handlerSem <- struct{}{}:
+			case <-done:
+				return nil
+			case <-ctx.Done():
+				return nil
+			}
+		}
+
+		go func() {
+			defer func() { <-d.handlerSem }()
+			h(m)
+		}()
+		return nil
+	})
+}
+
+// ListenWait is like ListenContext but if another Listen loop is running it waits for that loop to return and
+// then starts listening, rather than returning ErrAlreadyListening. If ctx is done while waiting then it returns
+// ctx.Err().
+func (d *Dev) ListenWait(ctx context.Context, h Handler) error {
+	for {
+		d.mu.Lock()
+		listenDone := d.listenDone
+		d.mu.Unlock()
+
+		if listenDone != nil {
+			select {
+			case <-listenDone:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		// Another caller may have started listening since the loop returned, in which case wait for it too.
+		if err := d.ListenContext(ctx, h); err != ErrAlreadyListening {
+			return err
+		}
+	}
+}
+
+// ListenE is like Listen but calls h synchronously, so measurements are handled one at a time in the order they
+// arrived. If h returns an error then listening stops and ListenE returns that error.
+func (d *Dev) ListenE(h HandlerE) error {
+	return d.listen(context.Background(), h)
+}
+
+// ListenOrdered is like Listen but runs h on one measurement at a time, in the order the measurements arrived.
+// Measurements are queued for h so that a slow handler doesn't immediately hold up reading from the sensor,
+// but once orderedBufferSize measurements are waiting reads block until h catches up. ListenOrdered doesn't
+// return until h has handled every queued measurement.
+func (d *Dev) ListenOrdered(h Handler) error {
+	ms := make(chan Measurement, orderedBufferSize)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for m := range ms {
+			h(m)
+		}
+	}()
+
+	err := d.listen(context.Background(), func(m Measurement) error {
+		ms <- m
+		return nil
+	})
+	close(ms)
+	wg.Wait()
+
+	return err
+}
+
+// Stream reads measurements in the background and sends them on the returned measurement channel until ctx is
+// done, Stop is called, or reading fails. A failure is sent on the error channel. Both channels are then closed.
+//
+// Stream never blocks reading on the consumer: measurements are buffered, and if streamBufferSize measurements
+// are already waiting then newly read measurements are dropped until the consumer catches up.
+func (d *Dev) Stream(ctx context.Context) (<-chan Measurement, <-chan error) {
+	ms := make(chan Measurement, streamBufferSize)
+	errc := make(chan error, 1)
+
+	go func() {
+		defer close(ms)
+		defer close(errc)
+
+		err := d.listen(ctx, func(m Measurement) error {
+			select {
+			case ms <- m:
+			default:
+			}
+			return nil
+		})
+		if err != nil && err != ctx.Err() {
+			errc <- err
+		}
+	}()
+
+	return ms, errc
+}
+
+// listen reads measurements until Stop is called or ctx is done, passing each to dispatch.
+// If dispatch returns an error then listen stops and returns it.
+func (d *Dev) listen(ctx context.Context, dispatch func(Measurement) error) error {
+	done, err := d.startListening()
+	if err != nil {
+		return err
+	}
+	return d.runListen(ctx, done, dispatch)
+}
+
+// startListening registers a Listen loop and returns the channel that Stop closes to end it, or ErrClosed or
+// ErrAlreadyListening if a loop can't be started. The caller must then run the loop with runListen.
+func (d *Dev) startListening() (chan struct{}, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		return nil, ErrClosed
+	}
+	if d.doneChan != nil {
+		return nil, ErrAlreadyListening
+	}
+
+	d.doneChan = make(chan struct{})
+	d.listenDone = make(chan struct{})
+	return d.doneChan, nil
+}
+
+// runListen is the loop of listen, registered by startListening, which returned done.
+func (d *Dev) runListen(ctx context.Context, done chan struct{}, dispatch func(Measurement) error) error {
+	defer func() {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+
+		// Reset the channels so Listen can be called again.
+		close(d.listenDone)
+		d.doneChan = nil
+		d.listenDone = nil
+	}()
+
+	// Cancel any in-flight read as soon as Stop is called rather than waiting out the read timeout.
+	readCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-done:
+			cancel()
+		case <-readCtx.Done():
+		}
+	}()
+
+	for {
+		select {
+		case <-done:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		// sense blocks for up to the port's read timeout, so this loop doesn't spin while the sensor is idle. The lock
+		// is released between reads so that other commands can run while listening.
+		d.ioMu.Lock()
+		m, err := d.sense(readCtx)
+		d.ioMu.Unlock()
+		if err == ErrTimeout || rejected(err) || (err != nil && readCtx.Err() != nil) {
+			// Rejected measurements are dropped rather than ending the loop.
+			continue
+		} else if err != nil {
+			if d.onReconnect == nil || d.open == nil {
+				return err
+			}
+			// Reconnecting only fails if Stop is called or ctx is done, which the top of the loop handles.
+			d.reconnect(readCtx, err)
+			continue
+		}
+		if err := dispatch(m); err != nil {
+			return err
+		}
+	}
+}
+
+// IsListening reports whether a Listen loop (or one of its variants) is running. It's still running, and
+// IsListening returns true, between a call to Stop and the loop returning.
+func (d *Dev) IsListening() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.doneChan != nil
+}
+
+// Stop ends the running Listen loop. An in-flight read is abandoned after at most one read from the serial
+// port, so Listen returns promptly.
+func (d *Dev) Stop() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	// If the channel is nil then we're not currently listening.
+	if d.doneChan == nil {
+		return
+	}
+
+	select {
+	case <-d.doneChan:
+		// Already closed. Don't close again.
+	default:
+		// Safe to close. We're the only closer, guarded by d.mu.
+		close(d.doneChan)
+	}
+}
+
+// Close stops any running Listen loop, waits for it to return, and then closes the serial port.
+// Calling Close more than once returns an error.
+func (d *Dev) Close() error {
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return ErrClosed
+	}
+	d.closed = true
+	listenDone := d.listenDone
+	d.mu.Unlock()
+
+	d.Stop()
+	if listenDone != nil {
+		<-listenDone
+	}
+	d.Record(nil)
+
+	var sleepErr error
+	if awake, known := d.awakeState(); d.keepAwake && (awake || !known) {
+		sleepErr = d.Sleep()
+	}
+
+	d.ioMu.Lock()
+	defer d.ioMu.Unlock()
+
+	if err := d.port.Close(); err != nil {
+		return err
+	}
+	return sleepErr
+}
+
+func (d *Dev) SetMode(m Mode) error {
+	return d.SetModeContext(context.Background(), m)
+}
+
+// SetModeContext is like SetMode but stops waiting for the response and returns ctx.Err() if ctx is done. The
+// other Context methods behave the same way.
+func (d *Dev) SetModeContext(ctx context.Context, m Mode) error {
+	d.ioMu.Lock()
+	defer d.ioMu.Unlock()
+
+	if err := d.setLocked(ctx, modeCommand, byte(m)); err != nil {
+		return err
+	}
+
+	// Measurements sent in active mode just before the switch may arrive after the response. Discard them so that
+	// they aren't taken as the response to the next query.
+	if m == ModeQuery {
+		return d.flushLocked()
+	}
+	return nil
+}
+
+// set sends cmd in its set form with the given value, and checks that the sensor echoes the value back. If it
+// doesn't then the sensor didn't apply the setting, and set returns an error wrapping ErrBadEcho.
+func (d *Dev) set(ctx context.Context, cmd command, value byte) error {
+	d.ioMu.Lock()
+	defer d.ioMu.Unlock()
+
+	return d.setLocked(ctx, cmd, value)
+}
+
+// setLocked is like set but the caller must hold d.ioMu.
+func (d *Dev) setLocked(ctx context.Context, cmd command, value byte) error {
+	b, err := d.commandLocked(ctx, cmd, 0x01, value)
+	if err != nil {
+		return err
+	}
+
+	if b[3] != 0x01 || b[4] != value {
+		return fmt.Errorf("%w to command 0x%02x, got %v, expected %v", ErrBadEcho, byte(cmd), fmtBytes(b[3:5]),
+			fmtBytes([]byte{0x01, value}))
+	}
+	return nil
+}
+
+// GetMode queries the sensor for its current reporting mode.
+func (d *Dev) GetMode() (Mode, error) {
+	return d.GetModeContext(context.Background())
+}
+
+// GetModeContext is like GetMode but stops waiting for the response if ctx is done.
+func (d *Dev) GetModeContext(ctx context.Context) (Mode, error) {
+	b, err := d.command(ctx, modeCommand, 0x00)
+	if err != nil {
+		return 0, err
+	}
+
+	m := Mode(b[4])
+	if m != ModeActive && m != ModeQuery {
+		return 0, fmt.Errorf("sds011: unknown reporting mode 0x%x", b[4])
+	}
+	return m, nil
+}
+
+func (d *Dev) SetDeviceID(id uint16) error {
+	return d.SetDeviceIDContext(context.Background(), id)
+}
+
+// SetDeviceIDContext is like SetDeviceID but stops waiting for the response if ctx is done.
+func (d *Dev) SetDeviceIDContext(ctx context.Context, id uint16) error {
+	d.ioMu.Lock()
+	defer d.ioMu.Unlock()
+
+	if err := d.flushLocked(); err != nil {
+		return err
+	}
+
+	// The new ID goes in the last two data bytes, which are bytes 13 and 14 of the frame.
+	data := make([]byte, maxDataLength)
+	copy(data[maxDataLength-2:], toBytes(id))
+	if err := d.write(deviceIDCommand, data); err != nil {
+		return err
+	}
+
+	// The response comes from the new ID.
+	if _, err := d.readAndValidateFrom(ctx, cmdTypeGeneral, deviceIDCommand, id, d.readTimeout); err != nil {
+		return err
+	}
+
+	// Address subsequent commands to the sensor's new ID, and expect measurements from it.
+	d.cfgMu.Lock()
+	d.id = id
+	d.cfgMu.Unlock()
+	d.mu.Lock()
+	d.haveLastID = false
+	d.mu.Unlock()
+	return nil
+}
+
+// SetTargetID sets the device ID that commands are addressed to, without communicating with the sensor. Responses
+// and measurements from other sensors are then ignored. By default commands are sent to BroadcastID, which
+// works with a single sensor on the line but not with several, since they would all respond. GetDeviceID
+// also sets the target ID.
+func (d *Dev) SetTargetID(id uint16) {
+	d.ioMu.Lock()
+	defer d.ioMu.Unlock()
+	d.cfgMu.Lock()
+	defer d.cfgMu.Unlock()
+
+	d.id = id
+}
+
+// SetDeviceIDVerified is like SetDeviceID but then reads the ID back from the sensor, addressing it by its new ID,
+// to confirm that it was adopted. It returns an error if the sensor doesn't answer to the new ID.
+func (d *Dev) SetDeviceIDVerified(id uint16) error {
+	return d.SetDeviceIDVerifiedContext(context.Background(), id)
+}
+
+// SetDeviceIDVerifiedContext is like SetDeviceIDVerified but stops waiting for responses if ctx is done.
+func (d *Dev) SetDeviceIDVerifiedContext(ctx context.Context, id uint16) error {
+	if err := d.SetDeviceIDContext(ctx, id); err != nil {
+		return err
+	}
+
+	got, err := d.GetDeviceIDContext(ctx)
+	if err != nil {
+		return fmt.Errorf("sds011: verifying device ID 0x%04x: %w", id, err)
+	}
+	if got != id {
+		return fmt.Errorf("sds011: device ID not adopted, got 0x%04x, expected 0x%04x", got, id)
+	}
+	return nil
+}
+
+// GetDeviceID returns the sensor's device ID. It issues a firmware version query, which doesn't change the
+// sensor's state, and reads the ID from the response. Subsequent commands are addressed to the returned ID.
+func (d *Dev) GetDeviceID() (uint16, error) {
+	return d.GetDeviceIDContext(context.Background())
+}
+
+// GetDeviceIDContext is like GetDeviceID but stops waiting for the response if ctx is done.
+func (d *Dev) GetDeviceIDContext(ctx context.Context) (uint16, error) {
+	d.ioMu.Lock()
+	defer d.ioMu.Unlock()
+
+	b, err := d.commandLocked(ctx, firmwareVersionCommand)
+	if err != nil {
+		return 0, err
+	}
+
+	id := packetID(b)
+	d.cfgMu.Lock()
+	d.id = id
+	d.cfgMu.Unlock()
+	return id, nil
+}
+
+func (d *Dev) sleepWake(ctx context.Context, sw byte) error {
+	if err := d.set(ctx, sleepWorkCommand, sw); err != nil {
+		return err
+	}
+
+	d.setAwake(sw == 0x01)
+	return nil
+}
+
+// setAwake records whether the sensor is awake.
+func (d *Dev) setAwake(awake bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.awake = awake
+	d.awakeKnown = true
+}
+
+// awakeState returns whether the sensor was last known to be awake, and whether that's known at all.
+func (d *Dev) awakeState() (awake, known bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.awake, d.awakeKnown
+}
+
+func (d *Dev) Sleep() error {
+	return d.SleepContext(context.Background())
+}
+
+// SleepContext is like Sleep but stops waiting for the response if ctx is done.
+func (d *Dev) SleepContext(ctx context.Context) error {
+	return d.sleepWake(ctx, 0x00)
+}
+
+func (d *Dev) Wake() error {
+	return d.WakeContext(context.Background())
+}
+
+// WakeContext is like Wake but stops waiting for the response if ctx is done.
+func (d *Dev) WakeContext(ctx context.Context) error {
+	return d.sleepWake(ctx, 0x01)
+}
+
+// GetSleepWorkState queries the sensor and reports whether it is working (true) or sleeping (false).
+func (d *Dev) GetSleepWorkState() (bool, error) {
+	return d.GetSleepWorkStateContext(context.Background())
+}
+
+// GetSleepWorkStateContext is like GetSleepWorkState but stops waiting for the response if ctx is done.
+func (d *Dev) GetSleepWorkStateContext(ctx context.Context) (bool, error) {
+	b, err := d.command(ctx, sleepWorkCommand, 0x00)
+	if err != nil {
+		return false, err
+	}
+
+	switch b[4] {
+	case 0x00:
+		d.setAwake(false)
+		return false, nil
+	case 0x01:
+		d.setAwake(true)
+		return true, nil
+	default:
+		return false, fmt.Errorf("sds011: unknown sleep/work state 0x%x", b[4])
+	}
+}
+
+func (d *Dev) SetPeriod(minutes int) error {
+	return d.SetPeriodContext(context.Background(), minutes)
+}
+
+// SetPeriodContext is like SetPeriod but stops waiting for the response if ctx is done.
+func (d *Dev) SetPeriodContext(ctx context.Context, minutes int) error {
+	if minutes < 0 || minutes > 30 {
+		return fmt.Errorf("sds011: working period must be in [0, 30]")
+	}
+
+	return d.set(ctx, workingPeriodCommand, byte(minutes))
+}
+
+// GetWorkingPeriod queries the sensor for its working period in minutes. A period of 0 means continuous operation.
+func (d *Dev) GetWorkingPeriod() (int, error) {
+	return d.GetWorkingPeriodContext(context.Background())
+}
+
+// GetWorkingPeriodContext is like GetWorkingPeriod but stops waiting for the response if ctx is done.
+func (d *Dev) GetWorkingPeriodContext(ctx context.Context) (int, error) {
+	b, err := d.command(ctx, workingPeriodCommand, 0x00)
+	if err != nil {
+		return 0, err
+	}
+
+	minutes := int(b[4])
+	if minutes > 30 {
+		return 0, fmt.Errorf("sds011: working period out of range, got %v, expected [0, 30]", minutes)
+	}
+	return minutes, nil
+}
+
+// ReportingInterval returns how often the sensor sends a measurement in ModeActive with the given working period
+// in minutes, as returned by GetWorkingPeriod: every second in continuous operation (a period of 0), and otherwise
+// once per period.
+func ReportingInterval(period int) time.Duration {
+	if period <= 0 {
+		return time.Second
+	}
+	return time.Duration(period) * time.Minute
+}
+
+func (d *Dev) GetFirmwareVersion() (FirmwareVersion, error) {
+	return d.GetFirmwareVersionContext(context.Background())
+}
+
+// GetFirmwareVersionContext is like GetFirmwareVersion but stops waiting for the response if ctx is done.
+func (d *Dev) GetFirmwareVersionContext(ctx context.Context) (FirmwareVersion, error) {
+	b, err := d.command(ctx, firmwareVersionCommand)
+	if err != nil {
+		return FirmwareVersion{}, err
+	}
+	return firmwareVersion(b), nil
+}
+
+// GetWorkingTime would return the sensor's cumulative working time, but the protocol has no command to read it,
+// so it always returns ErrUnsupported. Track the time the sensor is awake on the host instead.
+func (d *Dev) GetWorkingTime() (time.Duration, error) {
+	return 0, ErrUnsupported
+}
+
+// Ping checks that the sensor is responding. It queries the sleep/work state, which the sensor answers even while
+// asleep and which doesn't change its state, and returns nil if a valid response arrives within the read timeout.
+func (d *Dev) Ping() error {
+	return d.PingContext(context.Background())
+}
+
+// PingContext is like Ping but stops waiting for the response if ctx is done.
+func (d *Dev) PingContext(ctx context.Context) error {
+	_, err := d.command(ctx, sleepWorkCommand, 0x00)
+	return err
+}
+
+// firmwareVersion extracts the firmware version from a validated firmware version response.
+func firmwareVersion(b []byte) FirmwareVersion {
+	return FirmwareVersion{
+		Year:  int(b[3]),
+		Month: int(b[4]),
+		Day:   int(b[5]),
+	}
+}
+
+// SendCommand sends an arbitrary command to the sensor and returns the validated response packet. data holds the
+// (at most 12) data bytes that follow the command ID in the frame; the rest of the frame is filled in. This is
+// for experimenting with commands that the package doesn't otherwise support.
+func (d *Dev) SendCommand(cmd byte, data []byte) ([]byte, error) {
+	return d.SendCommandContext(context.Background(), cmd, data)
+}
+
+// SendCommandContext is like SendCommand but stops waiting for the response if ctx is done.
+func (d *Dev) SendCommandContext(ctx context.Context, cmd byte, data []byte) ([]byte, error) {
+	if len(data) > maxDataLength {
+		return nil, fmt.Errorf("sds011: too many data bytes, got %v, expected at most %v", len(data), maxDataLength)
+	}
+
+	return d.command(ctx, command(cmd), data...)
+}
+
+// command sends cmd with the given data bytes and returns the validated response.
+func (d *Dev) command(ctx context.Context, cmd command, data ...byte) ([]byte, error) {
+	d.ioMu.Lock()
+	defer d.ioMu.Unlock()
+
+	// The response is in a buffer that the next read reuses, so copy it before releasing the lock.
+	b, err := d.commandLocked(ctx, cmd, data...)
+	if b != nil {
+		b = append([]byte(nil), b...)
+	}
+	return b, err
+}
+
+// commandLocked is like command but the caller must hold d.ioMu. Commands whose response times out are re-sent
+// according to WithRetries.
+func (d *Dev) commandLocked(ctx context.Context, cmd command, data ...byte) ([]byte, error) {
+	for retry := 0; ; retry++ {
+		b, err := d.commandOnce(ctx, cmd, data...)
+		if err != ErrTimeout {
+			return b, err
+		}
+		if retry >= d.retries {
+			d.logf("no response to command 0x%02x", byte(cmd))
+			return b, err
+		}
+
+		d.logf("no response to command 0x%02x, retrying", byte(cmd))
+		if err := sleepContext(ctx, d.retryBackoff); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// commandOnce sends cmd with the given data bytes and returns the validated response. The caller must hold d.ioMu.
+func (d *Dev) commandOnce(ctx context.Context, cmd command, data ...byte) ([]byte, error) {
+	// In active mode the sensor sends a measurement every second, and any that haven't been read are still
+	// buffered. Discard them so they aren't mistaken for the response.
+	if cmd != queryCommand {
+		if err := d.flushLocked(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := d.write(cmd, data); err != nil {
+		return nil, err
+	}
+
+	typ := cmdTypeGeneral
+	if cmd == queryCommand {
+		typ = cmdTypeQuery
+	}
+	return d.readAndValidate(ctx, typ, cmd)
+}
+
+func (d *Dev) write(cmd command, data []byte) error {
+	b := EncodeCommand(byte(cmd), data, d.id)
+	d.logFrame("TX", b)
+	_, err := d.port.Write(b)
+	return err
+}
+
+// EncodeCommand returns the 19-byte frame that sends the command with the given ID and data bytes to the sensor
+// with the given device ID, or to every sensor on the line if it's BroadcastID. Data shorter than the frame's 12
+// data bytes is padded with zeros. This is the frame that a Dev writes, so it can be used to talk to the sensor
+// over another transport or to build a simulator. It panics if there are more than 12 data bytes.
+func EncodeCommand(cmd byte, data []byte, deviceID uint16) []byte {
+	if len(data) > maxDataLength {
+		panic(fmt.Sprintf("sds011: too many data bytes, got %v, expected at most %v", len(data), maxDataLength))
+	}
+
+	b := make([]byte, commandLength)
+	b[0], b[1], b[2] = head, 0xb4, cmd
+	copy(b[3:], data)
+	binary.BigEndian.PutUint16(b[3+maxDataLength:], deviceID)
+	b[commandLength-2] = Checksum(b[2 : commandLength-2])
+	b[commandLength-1] = tail
+	return b
+}
+
+// SetDebugWriter logs every frame written to the sensor and every packet read from it to w, one per line with
+// a timestamp and direction (TX or RX). A nil w turns logging off.
+func (d *Dev) SetDebugWriter(w io.Writer) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.debug = w
+}
+
+// LastPacket returns a copy of the last valid packet read from the sensor, or nil if there hasn't been one. This
+// is the raw packet behind the latest measurement or command response, for diagnosing suspect readings.
+func (d *Dev) LastPacket() []byte {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if len(d.lastPacket) == 0 {
+		return nil
+	}
+	return append([]byte(nil), d.lastPacket...)
+}
+
+// SetReadTimeout sets how long to wait for a valid response to a command. See WithReadTimeout. It waits for any
+// command in progress to finish. The timeout must be positive.
+func (d *Dev) SetReadTimeout(t time.Duration) error {
+	if t <= 0 {
+		return fmt.Errorf("sds011: read timeout must be positive, got %v", t)
+	}
+
+	d.ioMu.Lock()
+	defer d.ioMu.Unlock()
+	d.cfgMu.Lock()
+	defer d.cfgMu.Unlock()
+
+	d.readTimeout = t
+	return nil
+}
+
+// ReadTimeout returns how long the Dev waits for a valid response to a command.
+func (d *Dev) ReadTimeout() time.Duration {
+	d.cfgMu.Lock()
+	defer d.cfgMu.Unlock()
+
+	return d.readTimeout
+}
+
+func (d *Dev) logFrame(dir string, b []byte) {
+	// Check for a writer first to avoid formatting the frame for nothing, since this is called for every packet.
+	d.mu.Lock()
+	w := d.debug
+	d.mu.Unlock()
+
+	if w != nil {
+		d.debugf("%s %s", dir, fmtBytes(b))
+	}
+}
+
+// logf logs a diagnostic message to the logger and the debug writer.
+func (d *Dev) logf(format string, args ...interface{}) {
+	d.logger.Printf("sds011: "+format, args...)
+	d.debugf(format, args...)
+}
+
+// debugf writes a timestamped line to the debug writer, if there is one.
+func (d *Dev) debugf(format string, args ...interface{}) {
+	d.mu.Lock()
+	w := d.debug
+	d.mu.Unlock()
+
+	if w != nil {
+		fmt.Fprintf(w, "%s %s\n", time.Now().Format(debugTimeFormat), fmt.Sprintf(format, args...))
+	}
+}
+
+// reconfigurer is implemented by serial ports whose settings can be changed while they're open.
+type reconfigurer interface {
+	Reconfigure(opts ...serial.Option) error
+}
+
+// SetBaudRate changes the baud rate of the open serial port, for SDS011-compatible sensors that use a rate other
+// than the standard 9600. It doesn't send any command to the sensor. If the port rejects the rate then the error is
+// returned and the previous rate is restored. Reconnecting, if enabled, reopens the port at the new rate. It returns
+// an error if baud isn't positive or the port can't be reconfigured, as with most connections passed to
+// NewWithConn.
+func (d *Dev) SetBaudRate(baud int) error {
+	if baud <= 0 {
+		return fmt.Errorf("sds011: baud rate must be positive, got %v", baud)
+	}
+
+	d.ioMu.Lock()
+	defer d.ioMu.Unlock()
+
+	r, ok := d.port.(reconfigurer)
+	if !ok {
+		return errors.New("sds011: port doesn't support changing the baud rate")
+	}
+	if err := r.Reconfigure(serial.WithBaudrate(baud)); err != nil {
+		if d.baudRate > 0 {
+			r.Reconfigure(serial.WithBaudrate(d.baudRate))
+		}
+		return fmt.Errorf("sds011: setting baud rate to %v: %w", baud, err)
+	}
+
+	// Anything already read was received at the old rate.
+	d.rbuf = d.rbuf[:0]
+	d.baudRate = baud
+	return nil
+}
+
+// inputResetter is implemented by serial ports that can discard their input buffer.
+type inputResetter interface {
+	ResetInputBuffer() error
+}
+
+// Flush discards any data received from the sensor but not yet read, such as measurements sent in active mode,
+// and returns the number of packets discarded. Commands other than Sense flush automatically before they're sent.
+//
+// Flush drains the port by reading packets until a read times out or max has elapsed, whichever comes first, and
+// then discards anything left over, without counting it, if the port supports that. In active mode the sensor
+// sends a packet about once a second, so a drain normally ends with the first read after the backlog is cleared,
+// within the port read timeout; max bounds the drain in case the device sends continuously. If max isn't
+// positive then nothing is read, so only the port's own discard applies.
+func (d *Dev) Flush(max time.Duration) (int, error) {
+	d.ioMu.Lock()
+	defer d.ioMu.Unlock()
+
+	var n int
+	for deadline := time.Now().Add(max); time.Now().Before(deadline); n++ {
+		if _, err := d.read(); err == errNoData || errors.Is(err, ErrBadLength) {
+			// A read timed out, perhaps partway through a packet.
+			break
+		} else if err != nil {
+			return n, err
+		}
+	}
+
+	d.rbuf = d.rbuf[:0]
+	if r, ok := d.port.(inputResetter); ok {
+		return n, r.ResetInputBuffer()
+	}
+	return n, nil
+}
+
+// flushLocked is like Flush but the caller must hold d.ioMu. If the port can't discard its input buffer itself
+// then data is read and discarded until a read times out.
+func (d *Dev) flushLocked() error {
+	n := len(d.rbuf)
+	d.rbuf = d.rbuf[:0]
+
+	if r, ok := d.port.(inputResetter); ok {
+		if err := r.ResetInputBuffer(); err != nil {
+			return err
+		}
+	} else {
+		buf := make([]byte, 64)
+		for {
+			m, err := d.port.Read(buf)
+			n += m
+			if err != nil {
+				return err
+			}
+			if m == 0 {
+				break
+			}
+		}
+	}
+
+	if n > 0 {
+		d.logf("flushed %v bytes", n)
+	}
+	return nil
+}
+
+// packetTypes are the command types of packets sent by the sensor.
+var packetTypes = []byte{byte(cmdTypeQuery), byte(cmdTypeGeneral)}
+
+// errNoData is returned by read when a read from the port returns no data with nothing buffered. Serial ports
+// signal a read timeout that way rather than with an error, so it wraps ErrTimeout rather than ErrBadLength: it's
+// the normal result of reading while the sensor is idle, not a malformed packet. It's preallocated because that
+// happens often while waiting for data.
+var errNoData = fmt.Errorf("%w: no data from port", ErrTimeout)
+
+// read returns the next packet from the serial port. It doesn't fully validate the packet, but it does
+// resynchronize with the packet framing if bytes were dropped or injected on the line: bytes are discarded until a
+// header is found, and a candidate packet without a tail in the right place is skipped past its header. The
+// returned slice is only valid until the next call.
+func (d *Dev) read() ([]byte, error) {
+	for {
+		i := bytes.IndexByte(d.rbuf, head)
+		if i < 0 {
+			i = len(d.rbuf)
+		}
+		if i > 0 {
+			d.logf("discarded %v bytes to resynchronize: %s", i, fmtBytes(d.rbuf[:i]))
+			d.consume(i)
+		}
+
+		if len(d.rbuf) >= d.packetLen {
+			if d.rbuf[d.packetLen-1] == tail && contains(packetTypes, d.rbuf[1]) {
+				copy(d.packet, d.rbuf)
+				d.consume(d.packetLen)
+				d.logFrame("RX", d.packet)
+				return d.packet, nil
+			}
+
+			d.consume(1)
+			continue
+		}
+
+		// A packet may arrive over several reads, particularly with USB-serial adapters. Keep reading until the
+		// packet is complete or a read times out, which the serial port signals by returning no data.
+		if cap(d.rbuf) < d.packetLen {
+			d.rbuf = append(make([]byte, 0, d.packetLen), d.rbuf...)
+		}
+		n, err := d.port.Read(d.rbuf[len(d.rbuf):d.packetLen])
+		if n == 0 {
+			if err != nil {
+				return nil, err
+			}
+			if len(d.rbuf) == 0 {
+				return nil, errNoData
+			}
+			return nil, fmt.Errorf("%w, got %v, expected %v", ErrBadLength, len(d.rbuf), d.packetLen)
+		}
+
+		// If err is non-nil it'll be returned again by the next read, once the data that came with it is used.
+		d.rbuf = d.rbuf[:len(d.rbuf)+n]
+	}
+}
+
+// consume discards the first n bytes of d.rbuf, keeping the rest at the start of the buffer so it can be reused.
+func (d *Dev) consume(n int) {
+	d.rbuf = d.rbuf[:copy(d.rbuf, d.rbuf[n:])]
+}
+
+func (d *Dev) readAndValidate(ctx context.Context, typ commandType, cmd command) ([]byte, error) {
+	return d.readAndValidateFrom(ctx, typ, cmd, d.id, d.readTimeout)
+}
+
+// readAndValidateFrom is like readAndValidate but skips packets that weren't sent by the device with the given ID,
+// and gives up after the given timeout. Packets from any device are accepted if id is BroadcastID.
+func (d *Dev) readAndValidateFrom(ctx context.Context, typ commandType, cmd command, id uint16,
+	timeout time.Duration) ([]byte, error) {
+	start := time.Now()
+
+	b, err := d.read()
+	for err != nil || d.discard(b, typ, cmd, id) {
+		// Empty reads, and malformed and unwanted packets, are skipped until the timeout, but errors from the port
+		// itself end the read.
+		if err != nil && err != errNoData && !errors.Is(err, ErrBadLength) {
+			return nil, err
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if time.Now().Sub(start) >= timeout {
+			return b, ErrTimeout
+		}
+
+		b, err = d.read()
+	}
+
+	d.mu.Lock()
+	if d.rec != nil {
+		d.rec.record(b)
+	}
+	d.lastPacket = append(d.lastPacket[:0], b...)
+	d.mu.Unlock()
+
+	return b, err
+}
+
+// discard reports whether the packet b should be skipped because it isn't a valid response of the given type from
+// the device with the given ID, logging why if so.
+func (d *Dev) discard(b []byte, typ commandType, cmd command, id uint16) bool {
+	if err := validateLength(b, d.packetLen, typ, cmd); err != nil {
+		d.logf("discarded packet %s: %v", fmtBytes(b), err)
+		return true
+	}
+	if id != BroadcastID && packetID(b) != id {
+		d.logf("discarded packet %s from device 0x%04x", fmtBytes(b), packetID(b))
+		return true
+	}
+	return false
+}
+
+// DecodePacket decodes a measurement packet sent by the sensor, as read from the serial port, without needing a
+// Dev. It checks the packet's length, framing, type, and checksum, returning an error wrapping one of ErrBadLength,
+// ErrBadHeader, ErrBadTail, ErrBadCommandType, or ErrBadChecksum if it's invalid. The measurement's Time is zero,
+// since the packet doesn't record when it was sent.
+func DecodePacket(b []byte) (Measurement, error) {
+	if err := validate(b, cmdTypeQuery, queryCommand); err != nil {
+		return Measurement{}, err
+	}
+	return unmarshal(b)
+}
+
+// unmarshal decodes a measurement packet. Packets from clones may be longer than packetLength, but the
+// measurement is in the same place.
+func unmarshal(b []byte) (Measurement, error) {
+	if len(b) < packetLength {
+		return Measurement{}, fmt.Errorf("%w, got %v, expected at least %v", ErrBadLength, len(b), packetLength)
+	}
+
+	pm25, pm10 := rawConcentrations(b)
+	return Measurement{
+		PM25:       float32(pm25) / 10,
+		PM10:       float32(pm10) / 10,
+		DeviceID:   packetID(b),
+		pm25Tenths: pm25,
+		pm10Tenths: pm10,
+		raw:        true,
+	}, nil
+}
+
+// rawConcentrations returns the concentrations in a measurement packet as sent by the sensor, in tenths of μg/m³.
+func rawConcentrations(b []byte) (pm25, pm10 uint16) {
+	return binary.LittleEndian.Uint16(b[2:4]), binary.LittleEndian.Uint16(b[4:6])
+}
+
+func validate(b []byte, typ commandType, cmd command) error {
+	return validateLength(b, packetLength, typ, cmd)
+}
+
+// validateLength is like validate but for packets of length n, which end with the checksum and tail like standard
+// packets do.
+func validateLength(b []byte, n int, typ commandType, cmd command) error {
+	if len(b) != n {
+		return fmt.Errorf("%w, got %v, expected %v", ErrBadLength, len(b), n)
+	}
+
+	if b[0] != head {
+		return ErrBadHeader
+	}
+	if b[1] != byte(typ) {
+		return fmt.Errorf("%w, got 0x%x, want 0x%x", ErrBadCommandType, b[1], byte(typ))
+	}
+
+	// Query responses don't include the command byte because all the space is taken up by the measurement data.
+	if typ != cmdTypeQuery && b[2] != byte(cmd) {
+		return fmt.Errorf("%w, got 0x%x, want 0x%x", ErrBadCommandID, b[2], byte(cmd))
+	}
+
+	if b[n-1] != tail {
+		return ErrBadTail
+	}
+
+	if b[n-2] != Checksum(b[2:n-2]) {
+		return ErrBadChecksum
+	}
+
+	return nil
+}
+
+// Checksum returns the SDS011 protocol checksum of b: the sum of its bytes, truncated to the low 8 bits. In a
+// command frame it covers the data bytes and device ID (bytes 2 through 16), and in a response packet it covers
+// bytes 2 through 7.
+func Checksum(b []byte) byte {
+	var sum int
+	for _, v := range b {
+		sum += int(v)
+	}
+
+	return byte(sum & 0xff)
+}
+
+func toBytes(u uint16) []byte {
+	b := make([]byte, 2)
+	binary.BigEndian.PutUint16(b, u)
+	return b
+}
+
+// packetID returns the device ID from bytes 6 and 7 of a response packet.
+func packetID(b []byte) uint16 {
+	return binary.BigEndian.Uint16(b[6:8])
 }
 
 func contains(s []byte, b byte) bool {
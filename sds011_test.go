@@ -1,98 +1,496 @@
 package sds011
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"math"
+	"runtime"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	serial "github.com/albenik/go-serial/v2"
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 )
 
-var cmpFloats = cmp.Comparer(func(x, y float32) bool {
-	return math.Abs(float64(x-y)) < 0.00001
-})
+// cmpFloats compares float32s approximately. Since it's used to compare measurements, it also ignores the raw
+// concentrations that Measurement keeps for PM25Tenths and PM10Tenths; see ignoreRaw.
+var cmpFloats = cmp.Options{
+	cmp.Comparer(func(x, y float32) bool {
+		return math.Abs(float64(x-y)) < 0.00001
+	}),
+	ignoreRaw,
+}
+
+var ignoreTime = cmpopts.IgnoreFields(Measurement{}, "Time")
+
+// ignoreRaw ignores the raw concentrations that Measurement keeps for PM25Tenths and PM10Tenths, which
+// measurements built in tests don't have.
+var ignoreRaw = cmpopts.IgnoreUnexported(Measurement{})
+
+// fakeConn is an in-memory connection to a sensor. Bytes in buf are returned by Read, and each Write
+// appends the next entry of replies (if any) to buf, mimicking the sensor responding to a command.
+type fakeConn struct {
+	mu      sync.Mutex
+	buf     []byte
+	replies [][]byte
+	written [][]byte
+	closed  bool
+
+	// maxRead, if non-zero, is the most bytes returned by a single Read.
+	maxRead int
+
+	// readErr, if non-nil, is returned by every Read.
+	readErr error
+
+	// emptyReads is the number of Reads that return no data, like a read that times out, before buf is read.
+	emptyReads int
+
+	// respond, if non-nil, is used instead of replies to produce the reply to each Write.
+	respond func(written []byte) []byte
+}
+
+func (c *fakeConn) Read(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.readErr != nil {
+		return 0, c.readErr
+	}
+	if len(c.buf) == 0 || c.emptyReads > 0 {
+		if c.emptyReads > 0 {
+			c.emptyReads--
+		}
+		// Behave like a serial port read that times out.
+		c.mu.Unlock()
+		time.Sleep(time.Millisecond)
+		c.mu.Lock()
+		return 0, nil
+	}
+
+	if c.maxRead > 0 && len(p) > c.maxRead {
+		p = p[:c.maxRead]
+	}
+	n := copy(p, c.buf)
+	c.buf = c.buf[n:]
+	return n, nil
+}
+
+func (c *fakeConn) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.written = append(c.written, append([]byte(nil), p...))
+	if c.respond != nil {
+		c.buf = append(c.buf, c.respond(p)...)
+	} else if len(c.replies) > 0 {
+		c.buf = append(c.buf, c.replies[0]...)
+		c.replies = c.replies[1:]
+	}
+	return len(p), nil
+}
+
+func (c *fakeConn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.closed = true
+	return nil
+}
+
+// queryResponse returns a query response packet from device 0xa160 with the given concentrations in tenths of μg/m³.
+func queryResponse(pm25, pm10 uint16) []byte {
+	b := []byte{head, byte(cmdTypeQuery), byte(pm25), byte(pm25 >> 8), byte(pm10), byte(pm10 >> 8), 0xa1, 0x60, 0x00, tail}
+	b[8] = Checksum(b[2:8])
+	return b
+}
+
+// fromID returns packet b as if it were sent by the device with the given ID.
+func fromID(id uint16, b []byte) []byte {
+	b[6], b[7] = byte(id>>8), byte(id)
+	b[8] = Checksum(b[2:8])
+	return b
+}
+
+// generalResponse returns a response packet from device 0xa160 to the given command, with the given data bytes.
+func generalResponse(cmd command, data ...byte) []byte {
+	b := []byte{head, byte(cmdTypeGeneral), byte(cmd), 0x00, 0x00, 0x00, 0xa1, 0x60, 0x00, tail}
+	copy(b[3:6], data)
+	b[8] = Checksum(b[2:8])
+	return b
+}
+
+// echo responds to a command frame the way the sensor does, echoing the first two data bytes. Queries are
+// answered with the given query response.
+func echo(query []byte) func([]byte) []byte {
+	return func(w []byte) []byte {
+		if command(w[2]) == queryCommand {
+			return query
+		}
+		return generalResponse(command(w[2]), w[3], w[4])
+	}
+}
+
+func newFakeDev(c *fakeConn) *Dev {
+	return NewWithConn(c, WithReadTimeout(100*time.Millisecond))
+}
+
+// samplePackets are measurement packets sent by the sensor and the measurements they encode.
+var samplePackets = []struct {
+	name string
+	buf  []byte
+	want Measurement
+}{
+	{
+		"normal",
+		[]byte{0xaa, 0xc0, 0x2d, 0x00, 0xb8, 0x00, 0x54, 0x6f, 0xa8, 0xab},
+		Measurement{
+			PM25:     4.5,
+			PM10:     18.4,
+			DeviceID: 0x546f,
+		},
+	},
+	{
+		"zero",
+		[]byte{0xaa, 0xc0, 0x00, 0x00, 0x00, 0x00, 0x54, 0x6f, 0xc3, 0xab},
+		Measurement{
+			PM25:     0,
+			PM10:     0,
+			DeviceID: 0x546f,
+		},
+	},
+	{
+		"pm25 only",
+		[]byte{0xaa, 0xc0, 0x2d, 0x00, 0x00, 0x00, 0x54, 0x6f, 0xf0, 0xab},
+		Measurement{
+			PM25:     4.5,
+			PM10:     0,
+			DeviceID: 0x546f,
+		},
+	},
+	{
+		"pm10 only",
+		[]byte{0xaa, 0xc0, 0x00, 0x00, 0xb8, 0x00, 0x54, 0x6f, 0x7b, 0xab},
+		Measurement{
+			PM25:     0,
+			PM10:     18.4,
+			DeviceID: 0x546f,
+		},
+	},
+	{
+		"device id",
+		[]byte{0xaa, 0xc0, 0x2d, 0x00, 0xb8, 0x00, 0xa1, 0x60, 0xe6, 0xab},
+		Measurement{
+			PM25:     4.5,
+			PM10:     18.4,
+			DeviceID: 0xa160,
+		},
+	},
+}
 
 func TestUnmarshal(t *testing.T) {
+	for _, tc := range samplePackets {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := unmarshal(tc.buf)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			if diff := cmp.Diff(tc.want, got, cmpFloats); diff != "" {
+				t.Errorf("Unexpected result (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDecodePacket(t *testing.T) {
+	for _, tc := range samplePackets {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := DecodePacket(tc.buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if diff := cmp.Diff(tc.want, got, cmpFloats); diff != "" {
+				t.Errorf("Unexpected result (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDecodePacketInvalid(t *testing.T) {
 	cases := []struct {
 		name string
 		buf  []byte
-		want Measurement
+		want error
+	}{
+		{"short", []byte{0xaa, 0xc0, 0x2d, 0x00, 0xb8}, ErrBadLength},
+		{"bad checksum", []byte{0xaa, 0xc0, 0x2d, 0x00, 0xb8, 0x00, 0x54, 0x6f, 0xa9, 0xab}, ErrBadChecksum},
+		{"bad tail", []byte{0xaa, 0xc0, 0x2d, 0x00, 0xb8, 0x00, 0x54, 0x6f, 0xa8, 0xac}, ErrBadTail},
+		{"not a measurement", generalResponse(firmwareVersionCommand, 0x0f, 0x07, 0x0a), ErrBadCommandType},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := DecodePacket(tc.buf); !errors.Is(err, tc.want) {
+				t.Errorf("got error %v, want %v", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestMeasurementString(t *testing.T) {
+	cases := []struct {
+		name string
+		m    Measurement
+		want string
 	}{
 		{
-			"normal",
-			[]byte{0xaa, 0xc0, 0x2d, 0x00, 0xb8, 0x00, 0x54, 0x6f, 0xa8, 0xab},
-			Measurement{
-				PM25: 4.5,
-				PM10: 18.4,
-			},
-		},
-		{
-			"zero",
-			[]byte{0xaa, 0xc0, 0x00, 0x00, 0x00, 0x00, 0x54, 0x6f, 0xc3, 0xab},
-			Measurement{
-				PM25: 0,
-				PM10: 0,
-			},
-		},
-		{
-			"pm25 only",
-			[]byte{0xaa, 0xc0, 0x2d, 0x00, 0x00, 0x00, 0x54, 0x6f, 0xf0, 0xab},
-			Measurement{
-				PM25: 4.5,
-				PM10: 0,
-			},
+			"no time",
+			Measurement{PM25: 4.5, PM10: 18.4},
+			"PM2.5 = 4.5 μg/m³  PM10 = 18.4 μg/m³",
 		},
 		{
-			"pm10 only",
-			[]byte{0xaa, 0xc0, 0x00, 0x00, 0xb8, 0x00, 0x54, 0x6f, 0x7b, 0xab},
-			Measurement{
-				PM25: 0,
-				PM10: 18.4,
-			},
+			"time",
+			Measurement{PM25: 4.5, PM10: 18.4, Time: time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)},
+			"2021-03-04T05:06:07Z  PM2.5 = 4.5 μg/m³  PM10 = 18.4 μg/m³",
 		},
 	}
 
 	for _, tc := range cases {
 		t.Run(tc.name, func(t *testing.T) {
-			got, err := unmarshal(tc.buf)
-			if err != nil {
-				t.Error(err)
-				return
+			if got := tc.m.String(); got != tc.want {
+				t.Errorf("got %q, want %q", got, tc.want)
 			}
+		})
+	}
+}
 
-			if diff := cmp.Diff(tc.want, got, cmpFloats); diff != "" {
-				t.Errorf("Unexpected result (-want +got):\n%s", diff)
+func TestMeasurementFormat(t *testing.T) {
+	m := Measurement{PM25: 4.5, PM10: 18.4, DeviceID: 0xa160, Time: time.Date(2021, 3, 4, 5, 6, 7, 8e6, time.UTC)}
+
+	cases := []struct {
+		format string
+		m      Measurement
+		want   string
+	}{
+		{"%v", m, m.String()},
+		{"%s", m, m.String()},
+		{"%+v", m, "2021-03-04T05:06:07.008Z  PM2.5 = 4.5 μg/m³  PM10 = 18.4 μg/m³  id=0xa160"},
+		{"%6v", Measurement{PM25: 4.5, PM10: 118.4}, "PM2.5 =    4.5 μg/m³  PM10 =  118.4 μg/m³"},
+		{"%-6v", Measurement{PM25: 4.5, PM10: 118.4}, "PM2.5 = 4.5    μg/m³  PM10 = 118.4  μg/m³"},
+		{"%7.2v", Measurement{PM25: 4.5, PM10: 118.4}, "PM2.5 =    4.50 μg/m³  PM10 =  118.40 μg/m³"},
+		{"%d", Measurement{PM25: 4.5, PM10: 18.4}, "%!d(sds011.Measurement=PM2.5 = 4.5 μg/m³  PM10 = 18.4 μg/m³)"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.format, func(t *testing.T) {
+			if got := fmt.Sprintf(tc.format, tc.m); got != tc.want {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestMeasurementValid(t *testing.T) {
+	cases := []struct {
+		m    Measurement
+		want bool
+	}{
+		{Measurement{PM25: 0, PM10: 0}, true},
+		{Measurement{PM25: 4.5, PM10: 18.4}, true},
+		{Measurement{PM25: 999.9, PM10: 999.9}, true},
+		{Measurement{PM25: 1000, PM10: 18.4}, false},
+		{Measurement{PM25: 4.5, PM10: 6553.5}, false},
+		{Measurement{PM25: -1, PM10: 18.4}, false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.m.String(), func(t *testing.T) {
+			if got := tc.m.Valid(); got != tc.want {
+				t.Errorf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestMeasurementIsSaturated(t *testing.T) {
+	cases := []struct {
+		m    Measurement
+		want bool
+	}{
+		{Measurement{PM25: 999.9, PM10: 999.9}, true},
+		{Measurement{PM25: 999.8, PM10: 999.9}, false},
+		{Measurement{PM25: 999.9, PM10: 999.8}, false},
+		{Measurement{PM25: 999.8, PM10: 999.8}, false},
+		{Measurement{PM25: 4.5, PM10: 18.4}, false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.m.String(), func(t *testing.T) {
+			if got := tc.m.IsSaturated(); got != tc.want {
+				t.Errorf("got %v, want %v", got, tc.want)
 			}
 		})
 	}
 }
 
+func TestMeasurementEqual(t *testing.T) {
+	m := Measurement{PM25: 4.5, PM10: 18.4, DeviceID: 0xa160, Time: time.Unix(1, 0)}
+
+	cases := []struct {
+		name    string
+		other   Measurement
+		epsilon float32
+		want    bool
+	}{
+		{"identical", m, 0, true},
+		{"different time", Measurement{PM25: 4.5, PM10: 18.4, DeviceID: 0xa160}, 0, true},
+		{"within epsilon", Measurement{PM25: 4.6, PM10: 18.3, DeviceID: 0xa160}, 0.15, true},
+		{"PM2.5 outside epsilon", Measurement{PM25: 4.8, PM10: 18.4, DeviceID: 0xa160}, 0.15, false},
+		{"PM10 outside epsilon", Measurement{PM25: 4.5, PM10: 18.0, DeviceID: 0xa160}, 0.15, false},
+		{"different device", Measurement{PM25: 4.5, PM10: 18.4, DeviceID: 0xa161}, 0.15, false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := m.Equal(tc.other, tc.epsilon); got != tc.want {
+				t.Errorf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestMeasurementFloat64s(t *testing.T) {
+	m, err := DecodePacket(queryResponse(45, 184))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := m.PM25Float64(), 4.5; got != want {
+		t.Errorf("got PM2.5 %v, want %v", got, want)
+	}
+	if got, want := m.PM10Float64(), 18.4; got != want {
+		t.Errorf("got PM10 %v, want %v", got, want)
+	}
+	if got, want := m.Float64s(), [2]float64{4.5, 18.4}; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// Computed values, like an average or a changed concentration, aren't rounded to the sensor's resolution.
+	e := NewEMA(0.5)
+	e.Update(Measurement{PM25: 10.1, PM10: 20})
+	avg := e.Update(Measurement{PM25: 10.2, PM10: 20})
+	if got, want := avg.PM25Float64(), float64(float32(10.15)); got != want {
+		t.Errorf("got EMA PM2.5 %v, want %v", got, want)
+	}
+	m.PM10 = 18.45
+	if got, want := m.PM10Float64(), float64(float32(18.45)); got != want {
+		t.Errorf("got PM10 %v after changing it, want %v", got, want)
+	}
+}
+
+func TestMeasurementTenths(t *testing.T) {
+	// Every value the sensor can send survives conversion to float32 and back, including through encoding.
+	for v := 0; v <= math.MaxUint16; v++ {
+		m, err := unmarshal(queryResponse(uint16(v), uint16(v)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var fromJSON, fromBinary Measurement
+		b, _ := m.MarshalJSON()
+		if err := fromJSON.UnmarshalJSON(b); err != nil {
+			t.Fatal(err)
+		}
+		b, _ = m.MarshalBinary()
+		if err := fromBinary.UnmarshalBinary(b); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, m := range []Measurement{m, fromJSON, fromBinary} {
+			if m.PM25Tenths() != uint16(v) || m.PM10Tenths() != uint16(v) {
+				t.Fatalf("got %v, %v tenths from %v, want %v", m.PM25Tenths(), m.PM10Tenths(), m, v)
+			}
+		}
+	}
+
+	// A measurement from the sensor keeps the raw values, until its concentrations are changed.
+	m, err := DecodePacket(queryResponse(45, 184))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.raw || m.pm25Tenths != 45 || m.pm10Tenths != 184 {
+		t.Errorf("got raw values %v, %v, %v, want true, 45, 184", m.raw, m.pm25Tenths, m.pm10Tenths)
+	}
+	m.PM25 = 7
+	if got := m.PM25Tenths(); got != 70 {
+		t.Errorf("got %v tenths after changing PM25 to 7, want 70", got)
+	}
+	if got := m.PM10Tenths(); got != 184 {
+		t.Errorf("got %v PM10 tenths, want 184", got)
+	}
+
+	if got := (Measurement{PM25: -1}).PM25Tenths(); got != 0 {
+		t.Errorf("got %v tenths for a negative concentration, want 0", got)
+	}
+	if got := (Measurement{PM10: 1e6}).PM10Tenths(); got != math.MaxUint16 {
+		t.Errorf("got %v tenths for a huge concentration, want %v", got, math.MaxUint16)
+	}
+}
+
+func TestMeasurementDelta(t *testing.T) {
+	m := Measurement{PM25: 4.5, PM10: 18.4, DeviceID: 0xa160}
+	got := m.Delta(Measurement{PM25: 2, PM10: 20.4})
+
+	want := Measurement{PM25: 2.5, PM10: -2, DeviceID: 0xa160}
+	if diff := cmp.Diff(want, got, cmpFloats); diff != "" {
+		t.Errorf("Unexpected result (-want +got):\n%s", diff)
+	}
+}
+
 func TestValidateFailures(t *testing.T) {
 	cases := []struct {
 		name    string
 		buf     []byte
 		errText string
+		wantErr error
 	}{
 		{
 			"length",
 			[]byte{0xaa, 0xc0, 0x2d, 0x00, 0xb8, 0x00, 0x54, 0x6f, 0xa8},
 			"bad packet length",
+			ErrBadLength,
 		},
 		{
 			"header",
 			[]byte{0xab, 0xc0, 0x2d, 0x00, 0xb8, 0x00, 0x54, 0x6f, 0xa8, 0xab},
 			"bad header",
+			ErrBadHeader,
+		},
+		{
+			"command type",
+			[]byte{0xaa, 0xc5, 0x2d, 0x00, 0xb8, 0x00, 0x54, 0x6f, 0xa8, 0xab},
+			"incorrect command type",
+			ErrBadCommandType,
 		},
 		{
 			"tail",
 			[]byte{0xaa, 0xc0, 0x2d, 0x00, 0xb8, 0x00, 0x54, 0x6f, 0xa8, 0xac},
 			"bad tail",
+			ErrBadTail,
 		},
 		{
 			"checksum",
 			[]byte{0xaa, 0xc0, 0x2d, 0x00, 0xb8, 0x00, 0x54, 0x6f, 0xa9, 0xab},
 			"bad checksum",
+			ErrBadChecksum,
 		},
 	}
 
@@ -107,6 +505,9 @@ func TestValidateFailures(t *testing.T) {
 			if !strings.Contains(err.Error(), tc.errText) {
 				t.Errorf("want error with substring %q, got %q", tc.errText, err)
 			}
+			if !errors.Is(err, tc.wantErr) {
+				t.Errorf("want error wrapping %q, got %q", tc.wantErr, err)
+			}
 		})
 	}
 }
@@ -136,7 +537,7 @@ func TestChecksum(t *testing.T) {
 
 	for _, tc := range cases {
 		t.Run(fmt.Sprintf("%v", tc.b), func(t *testing.T) {
-			got := checksum(tc.b)
+			got := Checksum(tc.b)
 			if got != tc.want {
 				t.Errorf("got 0x%x, want 0x%x", got, tc.want)
 			}
@@ -144,6 +545,47 @@ func TestChecksum(t *testing.T) {
 	}
 }
 
+func TestEncodeCommand(t *testing.T) {
+	// Example frames from the protocol spec.
+	cases := []struct {
+		name     string
+		cmd      byte
+		data     []byte
+		deviceID uint16
+		want     []byte
+	}{
+		{
+			"set query mode",
+			byte(modeCommand),
+			[]byte{0x01, 0x01},
+			BroadcastID,
+			[]byte{0xaa, 0xb4, 0x02, 0x01, 0x01, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0xff, 0xff, 0x02, 0xab},
+		},
+		{
+			"query data",
+			byte(queryCommand),
+			nil,
+			BroadcastID,
+			[]byte{0xaa, 0xb4, 0x04, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0xff, 0xff, 0x02, 0xab},
+		},
+		{
+			"set device ID",
+			byte(deviceIDCommand),
+			[]byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0xa0, 0x01},
+			0xa160,
+			[]byte{0xaa, 0xb4, 0x05, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0xa0, 0x01, 0xa1, 0x60, 0xa7, 0xab},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if diff := cmp.Diff(tc.want, EncodeCommand(tc.cmd, tc.data, tc.deviceID)); diff != "" {
+				t.Errorf("Unexpected frame (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
 func TestToBytes(t *testing.T) {
 	got := toBytes(0xabcd)
 	want := []byte{0xab, 0xcd}
@@ -232,3 +674,1295 @@ func TestFmtBytes(t *testing.T) {
 		})
 	}
 }
+
+func TestPacketID(t *testing.T) {
+	b := []byte{0xaa, 0xc5, 0x07, 0x0f, 0x07, 0x0a, 0xa1, 0x60, 0x28, 0xab}
+	if got, want := packetID(b), uint16(0xa160); got != want {
+		t.Errorf("got 0x%x, want 0x%x", got, want)
+	}
+}
+
+func TestSense(t *testing.T) {
+	c := &fakeConn{
+		replies: [][]byte{{0xaa, 0xc0, 0x2d, 0x00, 0xb8, 0x00, 0x54, 0x6f, 0xa8, 0xab}},
+	}
+	d := newFakeDev(c)
+
+	got, err := d.Sense()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Measurement{PM25: 4.5, PM10: 18.4, DeviceID: 0x546f}
+	if diff := cmp.Diff(want, got, cmpFloats, ignoreTime); diff != "" {
+		t.Errorf("Unexpected result (-want +got):\n%s", diff)
+	}
+	if got.Time.IsZero() {
+		t.Error("want non-zero time")
+	}
+
+	wantWritten := []byte{0xaa, 0xb4, 0x04, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0xff, 0xff, 0x02, 0xab}
+	if diff := cmp.Diff([][]byte{wantWritten}, c.written); diff != "" {
+		t.Errorf("Unexpected bytes written (-want +got):\n%s", diff)
+	}
+}
+
+func TestSensePartialReads(t *testing.T) {
+	for _, maxRead := range []int{1, 3, 9} {
+		t.Run(fmt.Sprintf("%v", maxRead), func(t *testing.T) {
+			c := &fakeConn{
+				replies: [][]byte{queryResponse(50, 190)},
+				maxRead: maxRead,
+			}
+			d := newFakeDev(c)
+
+			got, err := d.Sense()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := Measurement{PM25: 5, PM10: 19, DeviceID: 0xa160}
+			if diff := cmp.Diff(want, got, cmpFloats, ignoreTime); diff != "" {
+				t.Errorf("Unexpected result (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSenseResync(t *testing.T) {
+	cases := []struct {
+		name    string
+		garbage []byte
+	}{
+		{"one byte", []byte{0x01}},
+		{"several bytes", []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c}},
+		{"false header", []byte{0xaa, 0x01, 0x02}},
+		{"truncated packet", queryResponse(40, 180)[:6]},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &fakeConn{
+				replies: [][]byte{append(append([]byte(nil), tc.garbage...), queryResponse(50, 190)...)},
+			}
+			d := newFakeDev(c)
+
+			got, err := d.Sense()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := Measurement{PM25: 5, PM10: 19, DeviceID: 0xa160}
+			if diff := cmp.Diff(want, got, cmpFloats, ignoreTime); diff != "" {
+				t.Errorf("Unexpected result (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSenseSkipsOtherDevices(t *testing.T) {
+	other := []byte{0xaa, 0xc0, 0x2d, 0x00, 0xb8, 0x00, 0x54, 0x6f, 0xa8, 0xab}
+	c := &fakeConn{
+		replies: [][]byte{append(other, queryResponse(50, 190)...)},
+	}
+	d := newFakeDev(c)
+	d.id = 0xa160
+
+	got, err := d.Sense()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Measurement{PM25: 5, PM10: 19, DeviceID: 0xa160}
+	if diff := cmp.Diff(want, got, cmpFloats, ignoreTime); diff != "" {
+		t.Errorf("Unexpected result (-want +got):\n%s", diff)
+	}
+}
+
+func TestSenseRangeCheck(t *testing.T) {
+	c := &fakeConn{
+		replies: [][]byte{queryResponse(10000, 190)},
+	}
+	d := NewWithConn(c, WithReadTimeout(100*time.Millisecond), WithRangeCheck())
+
+	if _, err := d.Sense(); !errors.Is(err, ErrOutOfRange) {
+		t.Errorf("got error %v, want %v", err, ErrOutOfRange)
+	}
+}
+
+func TestSenseStrictCheck(t *testing.T) {
+	c := &fakeConn{
+		replies: [][]byte{
+			queryResponse(50, 190),
+			fromID(0xa161, queryResponse(50, 190)),
+			queryResponse(10000, 190),
+			queryResponse(60, 200),
+		},
+	}
+	d := NewWithConn(c, WithReadTimeout(100*time.Millisecond), WithStrictCheck())
+
+	wantErrs := []error{nil, ErrDeviceIDChanged, ErrOutOfRange, nil}
+	for i, want := range wantErrs {
+		if _, err := d.Sense(); !errors.Is(err, want) {
+			t.Errorf("query %v: got error %v, want %v", i, err, want)
+		}
+	}
+}
+
+func TestSenseStrictCheckBadFirstID(t *testing.T) {
+	c := &fakeConn{
+		replies: [][]byte{
+			fromID(0xa161, queryResponse(50, 190)),
+			queryResponse(50, 190),
+			queryResponse(50, 190),
+			fromID(0xa161, queryResponse(50, 190)),
+			queryResponse(50, 190),
+			queryResponse(50, 190),
+			queryResponse(50, 190),
+			queryResponse(60, 200),
+		},
+	}
+	d := NewWithConn(c, WithReadTimeout(100*time.Millisecond), WithStrictCheck())
+
+	// The first ID is wrong, and the genuine one is accepted once 3 consecutive measurements agree on it.
+	wantErrs := []error{nil, ErrDeviceIDChanged, ErrDeviceIDChanged, nil, ErrDeviceIDChanged, ErrDeviceIDChanged, nil,
+		nil}
+	for i, want := range wantErrs {
+		if _, err := d.Sense(); !errors.Is(err, want) {
+			t.Errorf("query %v: got error %v, want %v", i, err, want)
+		}
+	}
+}
+
+func TestSenseSaturationCheck(t *testing.T) {
+	c := &fakeConn{
+		replies: [][]byte{queryResponse(9999, 9999), queryResponse(9998, 9999)},
+	}
+	d := NewWithConn(c, WithReadTimeout(100*time.Millisecond), WithSaturationCheck())
+
+	m, err := d.Sense()
+	if !errors.Is(err, ErrSaturated) {
+		t.Errorf("got error %v, want %v", err, ErrSaturated)
+	}
+	want := Measurement{PM25: 999.9, PM10: 999.9, DeviceID: 0xa160}
+	if diff := cmp.Diff(want, m, cmpFloats, ignoreTime); diff != "" {
+		t.Errorf("Unexpected result (-want +got):\n%s", diff)
+	}
+
+	if _, err := d.Sense(); err != nil {
+		t.Errorf("got error %v for a measurement just below saturation, want nil", err)
+	}
+}
+
+// padPacket returns packet b as a clone would send it, with n extra bytes before the checksum.
+func padPacket(b []byte, n int) []byte {
+	p := append(append([]byte(nil), b[:8]...), make([]byte, n)...)
+	for i := 8; i < len(p); i++ {
+		p[i] = byte(i)
+	}
+	p = append(p, 0, tail)
+	p[len(p)-2] = Checksum(p[2 : len(p)-2])
+	return p
+}
+
+func TestSensePacketLength(t *testing.T) {
+	c := &fakeConn{
+		replies: [][]byte{
+			padPacket(queryResponse(45, 184), 2),
+			queryResponse(45, 184), // Standard packets are the wrong length for this sensor.
+		},
+	}
+	d := NewWithConn(c, WithReadTimeout(50*time.Millisecond), WithPacketLength(12))
+
+	got, err := d.Sense()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(Measurement{PM25: 4.5, PM10: 18.4, DeviceID: 0xa160}, got, cmpFloats, ignoreTime); diff != "" {
+		t.Errorf("Unexpected result (-want +got):\n%s", diff)
+	}
+
+	if _, err := d.Sense(); err != ErrTimeout {
+		t.Errorf("got error %v for a standard packet, want %v", err, ErrTimeout)
+	}
+
+	// DecodePacket stays strict.
+	if _, err := DecodePacket(padPacket(queryResponse(45, 184), 2)); !errors.Is(err, ErrBadLength) {
+		t.Errorf("got error %v from DecodePacket, want %v", err, ErrBadLength)
+	}
+}
+
+func TestWithPacketLengthTooShort(t *testing.T) {
+	for _, n := range []int{0, 9} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("WithPacketLength(%v) didn't panic", n)
+				}
+			}()
+			WithPacketLength(n)
+		}()
+	}
+}
+
+func TestSenseTimeout(t *testing.T) {
+	d := newFakeDev(&fakeConn{})
+
+	if _, err := d.Sense(); err != ErrTimeout {
+		t.Errorf("got error %v, want %v", err, ErrTimeout)
+	}
+}
+
+func TestSenseEmptyReads(t *testing.T) {
+	// The port's reads time out several times, returning no data and no error, before the response arrives.
+	c := &fakeConn{
+		replies:    [][]byte{queryResponse(45, 184)},
+		emptyReads: 10,
+	}
+	l := &recordingLogger{}
+	d := NewWithConn(c, WithReadTimeout(100*time.Millisecond), WithLogger(l))
+
+	got, err := d.Sense()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(Measurement{PM25: 4.5, PM10: 18.4, DeviceID: 0xa160}, got, cmpFloats, ignoreTime); diff != "" {
+		t.Errorf("Unexpected result (-want +got):\n%s", diff)
+	}
+
+	// Empty reads are normal while waiting, so they aren't logged.
+	if len(l.msgs) != 0 {
+		t.Errorf("got log messages %q, want none", l.msgs)
+	}
+}
+
+func TestSetEcho(t *testing.T) {
+	setQueryMode := func(d *Dev) error { return d.SetMode(ModeQuery) }
+	setPeriod := func(d *Dev) error { return d.SetPeriod(5) }
+
+	cases := []struct {
+		name  string
+		reply []byte
+		set   func(d *Dev) error
+		want  error
+	}{
+		{"mode applied", generalResponse(modeCommand, 0x01, 0x01), setQueryMode, nil},
+		{"mode ignored", generalResponse(modeCommand, 0x01, 0x00), setQueryMode, ErrBadEcho},
+		{"period applied", generalResponse(workingPeriodCommand, 0x01, 0x05), setPeriod, nil},
+		{"period clamped", generalResponse(workingPeriodCommand, 0x01, 0x00), setPeriod, ErrBadEcho},
+		{"sleep applied", generalResponse(sleepWorkCommand, 0x01, 0x00), (*Dev).Sleep, nil},
+		{"sleep answered as query", generalResponse(sleepWorkCommand, 0x00, 0x00), (*Dev).Sleep, ErrBadEcho},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			d := newFakeDev(&fakeConn{replies: [][]byte{tc.reply}})
+			if err := tc.set(d); !errors.Is(err, tc.want) {
+				t.Errorf("got error %v, want %v", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestSetModeFlushesActivePackets(t *testing.T) {
+	// The sensor sends a measurement in active mode just before it switches to query mode, and it arrives after
+	// the response to the mode command.
+	c := &fakeConn{
+		respond: func(w []byte) []byte {
+			if command(w[2]) == modeCommand {
+				return append(generalResponse(modeCommand, w[3], w[4]), queryResponse(9990, 9990)...)
+			}
+			return queryResponse(45, 184)
+		},
+	}
+	d := newFakeDev(c)
+
+	if err := d.SetMode(ModeQuery); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := d.Sense()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Measurement{PM25: 4.5, PM10: 18.4, DeviceID: 0xa160}
+	if diff := cmp.Diff(want, got, cmpFloats, ignoreTime); diff != "" {
+		t.Errorf("Unexpected result (-want +got):\n%s", diff)
+	}
+}
+
+func TestGetMode(t *testing.T) {
+	c := &fakeConn{
+		// Response to a mode query reporting query mode.
+		replies: [][]byte{{0xaa, 0xc5, 0x02, 0x00, 0x01, 0x00, 0xa1, 0x60, 0x04, 0xab}},
+	}
+	d := newFakeDev(c)
+
+	got, err := d.GetMode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != ModeQuery {
+		t.Errorf("got mode %v, want %v", got, ModeQuery)
+	}
+}
+
+func TestCommandContext(t *testing.T) {
+	// The sensor never responds, and the read timeout is much longer than the context's deadline.
+	d := NewWithConn(&fakeConn{}, WithReadTimeout(10*time.Second))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if _, err := d.GetFirmwareVersionContext(ctx); err != context.DeadlineExceeded {
+		t.Errorf("got error %v, want %v", err, context.DeadlineExceeded)
+	}
+	if err := d.SetModeContext(ctx, ModeQuery); err != context.DeadlineExceeded {
+		t.Errorf("got error %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("commands took %v, want them to return soon after the deadline", elapsed)
+	}
+}
+
+func TestGetFirmwareVersion(t *testing.T) {
+	c := &fakeConn{
+		replies: [][]byte{{0xaa, 0xc5, 0x07, 0x0f, 0x07, 0x0a, 0xa1, 0x60, 0x28, 0xab}},
+	}
+	d := newFakeDev(c)
+
+	got, err := d.GetFirmwareVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := FirmwareVersion{Year: 15, Month: 7, Day: 10}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Unexpected result (-want +got):\n%s", diff)
+	}
+	if s := got.String(); s != "15-07-10" {
+		t.Errorf("got string %q, want %q", s, "15-07-10")
+	}
+}
+
+func TestGetWorkingTime(t *testing.T) {
+	c := &fakeConn{}
+	d := newFakeDev(c)
+
+	if _, err := d.GetWorkingTime(); err != ErrUnsupported {
+		t.Errorf("got error %v, want %v", err, ErrUnsupported)
+	}
+	if len(c.written) != 0 {
+		t.Errorf("got %v frames written, want none", len(c.written))
+	}
+}
+
+func TestPing(t *testing.T) {
+	c := &fakeConn{
+		replies: [][]byte{generalResponse(sleepWorkCommand, 0x00, 0x01)},
+	}
+	d := newFakeDev(c)
+
+	if err := d.Ping(); err != nil {
+		t.Errorf("got error %v, want nil", err)
+	}
+
+	// The reply has been used up, so the sensor is silent now.
+	if err := d.Ping(); err != ErrTimeout {
+		t.Errorf("got error %v, want %v", err, ErrTimeout)
+	}
+
+	// A sleeping sensor ignores most commands but still answers Ping.
+	d = newTestSimulator()
+	if err := d.SetReadTimeout(100 * time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Sleep(); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Ping(); err != nil {
+		t.Errorf("got error %v from sleeping sensor, want nil", err)
+	}
+}
+
+func TestProbe(t *testing.T) {
+	d := newFakeDev(&fakeConn{
+		replies: [][]byte{generalResponse(sleepWorkCommand, 0x00, 0x00)},
+	})
+	if err := d.probe(); err != nil {
+		t.Errorf("got error %v, want nil", err)
+	}
+
+	// A device that isn't an SDS011 sends something else, or nothing at all.
+	d = newFakeDev(&fakeConn{
+		replies: [][]byte{[]byte("$GPGGA,123519,4807.038,N\r\n")},
+	})
+	err := d.probe()
+	if !errors.Is(err, ErrNotSDS011) {
+		t.Errorf("got error %v, want %v", err, ErrNotSDS011)
+	}
+	if !errors.Is(err, ErrTimeout) {
+		t.Errorf("got error %v, want it to wrap %v", err, ErrTimeout)
+	}
+}
+
+func TestFlush(t *testing.T) {
+	// Measurements left over from active mode, and a stale response that would otherwise be taken as the answer.
+	stale := append(queryResponse(100, 200), generalResponse(firmwareVersionCommand, 0x01, 0x02, 0x03)...)
+	c := &fakeConn{
+		buf:     append(stale, queryResponse(300, 400)[:4]...),
+		replies: [][]byte{generalResponse(firmwareVersionCommand, 0x0f, 0x07, 0x0a)},
+	}
+	d := newFakeDev(c)
+
+	got, err := d.GetFirmwareVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (FirmwareVersion{Year: 15, Month: 7, Day: 10}); got != want {
+		t.Errorf("got firmware version %v, want %v", got, want)
+	}
+
+	c.buf = append(queryResponse(100, 200), queryResponse(300, 400)...)
+	c.buf = append(c.buf, queryResponse(500, 600)[:4]...)
+	n, err := d.Flush(time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("got %v packets flushed, want 2", n)
+	}
+	if len(c.buf) != 0 {
+		t.Errorf("Flush left %v bytes unread", len(c.buf))
+	}
+}
+
+func TestFlushMax(t *testing.T) {
+	// A device that never stops sending.
+	d := NewWithConn(&repeatConn{packet: queryResponse(100, 200)})
+
+	start := time.Now()
+	n, err := d.Flush(50 * time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Flush took %v, want it to stop after its limit", elapsed)
+	}
+	if n == 0 {
+		t.Error("got 0 packets flushed, want some")
+	}
+
+	// With no time to drain, nothing is read.
+	if n, err := d.Flush(0); err != nil || n != 0 {
+		t.Errorf("Flush(0) = %v, %v, want 0, nil", n, err)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	cases := []struct {
+		name        string
+		retries     int
+		wantErr     error
+		wantWritten int
+	}{
+		{"no retries", 0, ErrTimeout, 1},
+		{"retry succeeds", 2, nil, 2},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			// The sensor misses the first command.
+			c := &fakeConn{
+				replies: [][]byte{nil, generalResponse(firmwareVersionCommand, 0x0f, 0x07, 0x0a)},
+			}
+			d := NewWithConn(c, WithReadTimeout(20*time.Millisecond), WithRetries(tc.retries, time.Millisecond))
+
+			_, err := d.GetFirmwareVersion()
+			if err != tc.wantErr {
+				t.Errorf("got error %v, want %v", err, tc.wantErr)
+			}
+			if len(c.written) != tc.wantWritten {
+				t.Errorf("got %v commands written, want %v", len(c.written), tc.wantWritten)
+			}
+		})
+	}
+}
+
+func TestSetDeviceID(t *testing.T) {
+	// The command and response from the example in the datasheet, changing the ID from 0xa160 to 0xa001.
+	c := &fakeConn{
+		replies: [][]byte{{0xaa, 0xc5, 0x05, 0x00, 0x00, 0x00, 0xa0, 0x01, 0xa6, 0xab}},
+	}
+	d := newFakeDev(c)
+	d.id = 0xa160
+
+	if err := d.SetDeviceID(0xa001); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []byte{0xaa, 0xb4, 0x05, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xa0, 0x01,
+		0xa1, 0x60, 0xa7, 0xab}
+	if diff := cmp.Diff([][]byte{want}, c.written); diff != "" {
+		t.Errorf("Unexpected bytes written (-want +got):\n%s", diff)
+	}
+	if d.id != 0xa001 {
+		t.Errorf("got device ID 0x%x, want 0x%x", d.id, 0xa001)
+	}
+}
+
+func TestSetDeviceIDVerified(t *testing.T) {
+	cases := []struct {
+		name    string
+		replies [][]byte
+		wantErr error
+	}{
+		{
+			"adopted",
+			[][]byte{
+				fromID(0xa001, generalResponse(deviceIDCommand)),
+				fromID(0xa001, generalResponse(firmwareVersionCommand, 0x0f, 0x07, 0x0a)),
+			},
+			nil,
+		},
+		{
+			// The sensor acknowledges the change but keeps answering as 0xa160.
+			"not adopted",
+			[][]byte{
+				fromID(0xa001, generalResponse(deviceIDCommand)),
+				generalResponse(firmwareVersionCommand, 0x0f, 0x07, 0x0a),
+			},
+			ErrTimeout,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			d := newFakeDev(&fakeConn{replies: tc.replies})
+			d.id = 0xa160
+
+			if err := d.SetDeviceIDVerified(0xa001); !errors.Is(err, tc.wantErr) {
+				t.Errorf("got error %v, want %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestSetTargetID(t *testing.T) {
+	// Two sensors answer a query broadcast on the same line.
+	c := &fakeConn{
+		replies: [][]byte{append(queryResponse(45, 184), fromID(0xa161, queryResponse(50, 190))...)},
+	}
+	d := newFakeDev(c)
+	d.SetTargetID(0xa161)
+
+	got, err := d.Sense()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Measurement{PM25: 5, PM10: 19, DeviceID: 0xa161}
+	if diff := cmp.Diff(want, got, cmpFloats, ignoreTime); diff != "" {
+		t.Errorf("Unexpected result (-want +got):\n%s", diff)
+	}
+
+	// The query was addressed to the target.
+	if w := c.written[0]; w[15] != 0xa1 || w[16] != 0x61 {
+		t.Errorf("got command %v, want it addressed to 0xa161", fmtBytes(w))
+	}
+}
+
+func TestSendCommand(t *testing.T) {
+	resp := generalResponse(firmwareVersionCommand, 0x0f, 0x07, 0x0a)
+	c := &fakeConn{replies: [][]byte{resp}}
+	d := newFakeDev(c)
+
+	got, err := d.SendCommand(0x07, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(resp, got); diff != "" {
+		t.Errorf("Unexpected result (-want +got):\n%s", diff)
+	}
+
+	if _, err := d.SendCommand(0x07, make([]byte, 13)); err == nil {
+		t.Error("want error for too many data bytes, got nil")
+	}
+}
+
+func TestLastPacket(t *testing.T) {
+	c := &fakeConn{
+		replies: [][]byte{queryResponse(45, 184)},
+	}
+	d := newFakeDev(c)
+
+	if got := d.LastPacket(); got != nil {
+		t.Errorf("got %v before any reads, want nil", fmtBytes(got))
+	}
+
+	if _, err := d.Sense(); err != nil {
+		t.Fatal(err)
+	}
+
+	got := d.LastPacket()
+	if diff := cmp.Diff(queryResponse(45, 184), got); diff != "" {
+		t.Errorf("Unexpected packet (-want +got):\n%s", diff)
+	}
+
+	// Changing the returned packet doesn't change the stored one.
+	got[2] = 0
+	if diff := cmp.Diff(queryResponse(45, 184), d.LastPacket()); diff != "" {
+		t.Errorf("Unexpected packet after modifying copy (-want +got):\n%s", diff)
+	}
+}
+
+func TestSetReadTimeout(t *testing.T) {
+	d := newFakeDev(&fakeConn{})
+
+	if err := d.SetReadTimeout(5 * time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if got := d.ReadTimeout(); got != 5*time.Millisecond {
+		t.Errorf("got read timeout %v, want %v", got, 5*time.Millisecond)
+	}
+
+	start := time.Now()
+	if _, err := d.Sense(); err != ErrTimeout {
+		t.Errorf("got error %v, want %v", err, ErrTimeout)
+	}
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("Sense took %v, want it to time out after about 5ms", elapsed)
+	}
+
+	for _, bad := range []time.Duration{0, -time.Second} {
+		if err := d.SetReadTimeout(bad); err == nil {
+			t.Errorf("SetReadTimeout(%v) succeeded, want an error", bad)
+		}
+	}
+	if got := d.ReadTimeout(); got != 5*time.Millisecond {
+		t.Errorf("got read timeout %v after rejected changes, want %v", got, 5*time.Millisecond)
+	}
+}
+
+func TestWithReadTimeoutNonPositive(t *testing.T) {
+	for _, bad := range []time.Duration{0, -time.Second} {
+		d := NewWithConn(&fakeConn{}, WithReadTimeout(bad))
+		if got := d.ReadTimeout(); got != defaultTimeout {
+			t.Errorf("WithReadTimeout(%v): got read timeout %v, want the default %v", bad, got, defaultTimeout)
+		}
+	}
+}
+
+// reconfigConn is a fakeConn that can be reconfigured like a serial port.
+type reconfigConn struct {
+	*fakeConn
+	reconfigs int
+	err       error
+}
+
+func (c *reconfigConn) Reconfigure(opts ...serial.Option) error {
+	c.reconfigs++
+	return c.err
+}
+
+func TestSetBaudRate(t *testing.T) {
+	c := &reconfigConn{fakeConn: &fakeConn{}}
+	d := NewWithConn(c)
+
+	if err := d.SetBaudRate(0); err == nil {
+		t.Error("got nil error for a baud rate of 0")
+	}
+	if c.reconfigs != 0 {
+		t.Errorf("port reconfigured %v times for an invalid baud rate", c.reconfigs)
+	}
+
+	if err := d.SetBaudRate(115200); err != nil {
+		t.Fatal(err)
+	}
+	if d.baudRate != 115200 {
+		t.Errorf("got baud rate %v, want 115200", d.baudRate)
+	}
+
+	// The adapter rejects the rate, so the previous one is restored.
+	rejected := errors.New("invalid speed")
+	c.err = rejected
+	c.reconfigs = 0
+	if err := d.SetBaudRate(123); !errors.Is(err, rejected) {
+		t.Errorf("got error %v, want %v", err, rejected)
+	}
+	if d.baudRate != 115200 || c.reconfigs != 2 {
+		t.Errorf("got baud rate %v after %v reconfigures, want 115200 after 2", d.baudRate, c.reconfigs)
+	}
+
+	d = NewWithConn(&fakeConn{})
+	if err := d.SetBaudRate(9600); err == nil {
+		t.Error("got nil error for a port that can't be reconfigured")
+	}
+}
+
+func TestDevString(t *testing.T) {
+	d := newFakeDev(&fakeConn{})
+	if got, want := d.String(), "sds011 id=0xffff timeout=100ms"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	if got := d.Name(); got != "" {
+		t.Errorf("got name %q, want empty", got)
+	}
+
+	d.name = "/dev/ttyUSB0"
+	d.id = 0xa160
+	if got, want := d.Name(), "/dev/ttyUSB0"; got != want {
+		t.Errorf("got name %q, want %q", got, want)
+	}
+	if got, want := d.String(), "sds011 /dev/ttyUSB0 id=0xa160 timeout=100ms"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// String doesn't wait for a command in progress.
+	d.ioMu.Lock()
+	defer d.ioMu.Unlock()
+	done := make(chan struct{})
+	go func() {
+		_ = d.String()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("String blocked while the port was in use")
+	}
+}
+
+func TestClose(t *testing.T) {
+	c := &fakeConn{buf: bytes.Repeat(queryResponse(45, 184), 3)}
+	d := newFakeDev(c)
+
+	got := make(chan Measurement, 3)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- d.Listen(func(m Measurement) {
+			got <- m
+		})
+	}()
+
+	select {
+	case <-got:
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for measurement")
+	}
+
+	if err := d.Close(); err != nil {
+		t.Fatalf("Close returned error: %v", err)
+	}
+
+	select {
+	case err := <-errc:
+		if err != nil {
+			t.Errorf("Listen returned error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Listen didn't return after Close")
+	}
+
+	c.mu.Lock()
+	closed := c.closed
+	c.mu.Unlock()
+	if !closed {
+		t.Error("Close didn't close the port")
+	}
+
+	if err := d.Close(); err != ErrClosed {
+		t.Errorf("Second Close returned %v, want %v", err, ErrClosed)
+	}
+}
+
+func TestCloseKeepAwake(t *testing.T) {
+	c := &fakeConn{respond: echo(nil)}
+	d := NewWithConn(c, WithReadTimeout(100*time.Millisecond), WithKeepAwake())
+	if err := d.Wake(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	last := c.written[len(c.written)-1]
+	if command(last[2]) != sleepWorkCommand || last[3] != 0x01 || last[4] != 0x00 {
+		t.Errorf("got last command %v, want sleep", fmtBytes(last))
+	}
+	if !c.closed {
+		t.Error("connection wasn't closed")
+	}
+}
+
+type recordingLogger struct {
+	mu   sync.Mutex
+	msgs []string
+}
+
+func (l *recordingLogger) Printf(format string, v ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.msgs = append(l.msgs, fmt.Sprintf(format, v...))
+}
+
+func TestLogger(t *testing.T) {
+	// Garbage, a packet from another device, and a good packet, after which the next query times out.
+	reply := append([]byte{0x01, 0x02}, fromID(0xa161, queryResponse(50, 190))...)
+	c := &fakeConn{
+		replies: [][]byte{append(reply, queryResponse(45, 184)...)},
+	}
+	l := &recordingLogger{}
+	d := NewWithConn(c, WithReadTimeout(20*time.Millisecond), WithLogger(l))
+	d.id = 0xa160
+
+	if _, err := d.Sense(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Sense(); err != ErrTimeout {
+		t.Fatalf("got error %v, want %v", err, ErrTimeout)
+	}
+
+	want := []string{
+		"sds011: discarded 2 bytes to resynchronize: [0x1, 0x2]",
+		"sds011: discarded packet [0xaa, 0xc0, 0x32, 0x0, 0xbe, 0x0, 0xa1, 0x61, 0xf2, 0xab] from device 0xa161",
+		"sds011: no response to command 0x04",
+	}
+	if diff := cmp.Diff(want, l.msgs); diff != "" {
+		t.Errorf("Unexpected log messages (-want +got):\n%s", diff)
+	}
+}
+
+func TestDebugWriter(t *testing.T) {
+	c := &fakeConn{
+		replies: [][]byte{queryResponse(50, 190)},
+	}
+	d := newFakeDev(c)
+
+	var buf bytes.Buffer
+	d.SetDebugWriter(&buf)
+	if _, err := d.Sense(); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	want := []string{
+		"TX [0xaa, 0xb4, 0x4, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0xff, 0xff, 0x2, 0xab]",
+		"RX [0xaa, 0xc0, 0x32, 0x0, 0xbe, 0x0, 0xa1, 0x60, 0xf1, 0xab]",
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("got %v lines, want %v:\n%s", len(lines), len(want), buf.String())
+	}
+	for i, line := range lines {
+		if !strings.HasSuffix(line, " "+want[i]) {
+			t.Errorf("got line %q, want suffix %q", line, want[i])
+		}
+	}
+}
+
+func TestWaitForData(t *testing.T) {
+	c := &fakeConn{
+		buf: append(queryResponse(45, 184), queryResponse(50, 190)...),
+	}
+	d := newFakeDev(c)
+
+	got, err := d.WaitForData(50 * time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Measurement{PM25: 4.5, PM10: 18.4, DeviceID: 0xa160}
+	if diff := cmp.Diff(want, got, cmpFloats, ignoreTime); diff != "" {
+		t.Errorf("Unexpected result (-want +got):\n%s", diff)
+	}
+	if len(c.written) != 0 {
+		t.Errorf("got %v commands written, want none", len(c.written))
+	}
+
+	// The second measurement is left for the next read.
+	if diff := cmp.Diff(queryResponse(50, 190), c.buf); diff != "" {
+		t.Errorf("Unexpected unread bytes (-want +got):\n%s", diff)
+	}
+
+	c.buf = nil
+	if _, err := d.WaitForData(20 * time.Millisecond); err != ErrTimeout {
+		t.Errorf("got error %v, want %v", err, ErrTimeout)
+	}
+}
+
+func TestListen(t *testing.T) {
+	c := &fakeConn{
+		buf: bytes.Repeat([]byte{0xaa, 0xc0, 0x2d, 0x00, 0xb8, 0x00, 0x54, 0x6f, 0xa8, 0xab}, 3),
+	}
+	d := newFakeDev(c)
+
+	got := make(chan Measurement, 3)
+	errc := make(chan error)
+	go func() {
+		errc <- d.Listen(func(m Measurement) {
+			got <- m
+		})
+	}()
+
+	for i := 0; i < 3; i++ {
+		select {
+		case m := <-got:
+			if diff := cmp.Diff(Measurement{PM25: 4.5, PM10: 18.4, DeviceID: 0x546f}, m, cmpFloats, ignoreTime); diff != "" {
+				t.Errorf("Unexpected result (-want +got):\n%s", diff)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for measurement")
+		}
+	}
+
+	d.Stop()
+	if err := <-errc; err != nil {
+		t.Errorf("Listen returned error: %v", err)
+	}
+}
+
+func TestListenSynchronousHandler(t *testing.T) {
+	c := &fakeConn{}
+	for i := uint16(1); i <= 5; i++ {
+		c.buf = append(c.buf, queryResponse(i*10, i*10)...)
+	}
+	d := NewWithConn(c, WithReadTimeout(100*time.Millisecond), WithSynchronousHandler())
+
+	// The handler runs in Listen's goroutine, so it can record measurements without synchronization.
+	var got []float32
+	err := d.Listen(func(m Measurement) {
+		got = append(got, m.PM25)
+		if len(got) == 5 {
+			d.Stop()
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff([]float32{1, 2, 3, 4, 5}, got, cmpFloats); diff != "" {
+		t.Errorf("Unexpected measurements (-want +got):\n%s", diff)
+	}
+}
+
+func TestListenMaxHandlerGoroutines(t *testing.T) {
+	const max = 3
+
+	for _, drop := range []bool{false, true} {
+		t.Run(fmt.Sprintf("drop=%v", drop), func(t *testing.T) {
+			// The sensor sends measurements as fast as they can be read, and every handler stalls.
+			d := NewWithConn(&repeatConn{packet: queryResponse(40, 180)}, WithMaxHandlerGoroutines(max, drop))
+
+			base := runtime.NumGoroutine()
+			release := make(chan struct{})
+			var running, peak, calls int32
+			errc := make(chan error)
+			go func() {
+				errc <- d.Listen(func(m Measurement) {
+					n := atomic.AddInt32(&running, 1)
+					atomic.AddInt32(&calls, 1)
+					for {
+						p := atomic.LoadInt32(&peak)
+						if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+							break
+						}
+					}
+					<-release
+					atomic.AddInt32(&running, -1)
+				})
+			}()
+
+			time.Sleep(50 * time.Millisecond)
+			// Allow for the Listen goroutine and the one it uses to watch for Stop.
+			if got := runtime.NumGoroutine() - base; got > max+2 {
+				t.Errorf("got %v extra goroutines, want at most %v", got, max+2)
+			}
+
+			// Stop doesn't wait for the stalled handlers.
+			d.Stop()
+			if err := <-errc; err != nil {
+				t.Errorf("Listen returned error: %v", err)
+			}
+			close(release)
+
+			if got := atomic.LoadInt32(&peak); got != max {
+				t.Errorf("got %v concurrent handlers, want %v", got, max)
+			}
+			// Further measurements either waited for a handler to return, which none did before Stop, or were dropped.
+			if got := atomic.LoadInt32(&calls); got != max {
+				t.Errorf("got %v handler calls, want %v", got, max)
+			}
+		})
+	}
+}
+
+func TestIsListening(t *testing.T) {
+	d := newFakeDev(&fakeConn{})
+	if d.IsListening() {
+		t.Error("IsListening is true before Listen")
+	}
+
+	errc := make(chan error)
+	go func() {
+		errc <- d.Listen(func(Measurement) {})
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for !d.IsListening() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for IsListening to be true")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	d.Stop()
+	if err := <-errc; err != nil {
+		t.Errorf("Listen returned error: %v", err)
+	}
+	if d.IsListening() {
+		t.Error("IsListening is true after Listen returned")
+	}
+}
+
+func TestListenWait(t *testing.T) {
+	d := newFakeDev(&fakeConn{buf: queryResponse(45, 184)})
+
+	first := make(chan error)
+	go func() {
+		first <- d.Listen(func(Measurement) {})
+	}()
+	for !d.IsListening() {
+		time.Sleep(time.Millisecond)
+	}
+
+	// While the first loop runs, ListenWait waits rather than failing.
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := d.ListenWait(ctx, func(Measurement) {}); err != context.DeadlineExceeded {
+		t.Errorf("got error %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	second := make(chan error)
+	go func() {
+		second <- d.ListenWait(context.Background(), func(Measurement) {})
+	}()
+
+	d.Stop()
+	if err := <-first; err != nil {
+		t.Errorf("Listen returned error: %v", err)
+	}
+
+	// The second loop takes over once the first returns.
+	deadline := time.Now().Add(time.Second)
+	for !d.IsListening() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for ListenWait to start listening")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	d.Stop()
+	if err := <-second; err != nil {
+		t.Errorf("ListenWait returned error: %v", err)
+	}
+}
+
+func TestListenOrdered(t *testing.T) {
+	c := &fakeConn{}
+	for i := uint16(0); i < 5; i++ {
+		c.buf = append(c.buf, queryResponse(i, i)...)
+	}
+	d := newFakeDev(c)
+
+	var got []float32
+	done := make(chan struct{})
+	errc := make(chan error)
+	go func() {
+		errc <- d.ListenOrdered(func(m Measurement) {
+			// Slow handling must not reorder measurements.
+			time.Sleep(5 * time.Millisecond)
+			got = append(got, m.PM25)
+			if len(got) == 5 {
+				close(done)
+			}
+		})
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for measurements")
+	}
+
+	d.Stop()
+	if err := <-errc; err != nil {
+		t.Errorf("ListenOrdered returned error: %v", err)
+	}
+
+	want := []float32{0, 0.1, 0.2, 0.3, 0.4}
+	if diff := cmp.Diff(want, got, cmpFloats); diff != "" {
+		t.Errorf("Unexpected result (-want +got):\n%s", diff)
+	}
+}
+
+func TestStopInterruptsRead(t *testing.T) {
+	// With a long read timeout, Stop must not wait for the read to time out.
+	d := NewWithConn(&fakeConn{}, WithReadTimeout(10*time.Second))
+
+	errc := make(chan error)
+	go func() {
+		errc <- d.Listen(func(m Measurement) {})
+	}()
+
+	// Give Listen time to start reading.
+	time.Sleep(20 * time.Millisecond)
+
+	d.Stop()
+	select {
+	case err := <-errc:
+		if err != nil {
+			t.Errorf("Listen returned error: %v", err)
+		}
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("Listen didn't return promptly after Stop")
+	}
+}
+
+func TestStream(t *testing.T) {
+	c := &fakeConn{}
+	for i := uint16(0); i < 3; i++ {
+		c.buf = append(c.buf, queryResponse(i, i)...)
+	}
+	d := newFakeDev(c)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ms, errc := d.Stream(ctx)
+
+	var got []float32
+	for len(got) < 3 {
+		select {
+		case m := <-ms:
+			got = append(got, m.PM25)
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for measurement")
+		}
+	}
+
+	want := []float32{0, 0.1, 0.2}
+	if diff := cmp.Diff(want, got, cmpFloats); diff != "" {
+		t.Errorf("Unexpected result (-want +got):\n%s", diff)
+	}
+
+	cancel()
+	for range ms {
+	}
+	if err, ok := <-errc; ok {
+		t.Errorf("got error %v, want closed channel", err)
+	}
+}
+
+func TestListenE(t *testing.T) {
+	c := &fakeConn{}
+	for i := uint16(0); i < 5; i++ {
+		c.buf = append(c.buf, queryResponse(i, i)...)
+	}
+	d := newFakeDev(c)
+
+	sinkErr := errors.New("sink failed")
+	var got []float32
+	err := d.ListenE(func(m Measurement) error {
+		got = append(got, m.PM25)
+		if len(got) == 2 {
+			return sinkErr
+		}
+		return nil
+	})
+	if err != sinkErr {
+		t.Errorf("got error %v, want %v", err, sinkErr)
+	}
+
+	want := []float32{0, 0.1}
+	if diff := cmp.Diff(want, got, cmpFloats); diff != "" {
+		t.Errorf("Unexpected result (-want +got):\n%s", diff)
+	}
+
+	if d.doneChan != nil {
+		t.Error("want listening state reset after ListenE returns")
+	}
+}
+
+func TestConcurrentCommands(t *testing.T) {
+	c := &fakeConn{respond: echo(queryResponse(50, 190))}
+	d := newFakeDev(c)
+
+	errc := make(chan error)
+	go func() {
+		errc <- d.Listen(func(Measurement) {})
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				m, err := d.Sense()
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if diff := cmp.Diff(Measurement{PM25: 5, PM10: 19, DeviceID: 0xa160}, m, cmpFloats, ignoreTime); diff != "" {
+					t.Errorf("Unexpected result (-want +got):\n%s", diff)
+				}
+				if _, err := d.GetMode(); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	d.Stop()
+	if err := <-errc; err != nil {
+		t.Errorf("Listen returned error: %v", err)
+	}
+}
+
+// repeatConn returns the same packet from every read, as a sensor in active mode would if reads were slow.
+type repeatConn struct {
+	packet []byte
+	off    int
+}
+
+func (c *repeatConn) Read(p []byte) (int, error) {
+	n := copy(p, c.packet[c.off:])
+	c.off = (c.off + n) % len(c.packet)
+	return n, nil
+}
+
+func (c *repeatConn) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+func (c *repeatConn) Close() error {
+	return nil
+}
+
+// BenchmarkListenRead measures the read path used by Listen, which shouldn't allocate.
+func BenchmarkListenRead(b *testing.B) {
+	d := NewWithConn(&repeatConn{packet: queryResponse(45, 184)})
+	ctx := context.Background()
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		d.ioMu.Lock()
+		_, err := d.sense(ctx)
+		d.ioMu.Unlock()
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package sds011
+
+import "context"
+
+// SelfTestError is returned by SelfTest when one of its steps fails.
+type SelfTestError struct {
+	// Step describes the step that failed, such as "wake" or "sample".
+	Step string
+	Err  error
+}
+
+func (e *SelfTestError) Error() string {
+	return "sds011: self-test failed at " + e.Step + ": " + e.Err.Error()
+}
+
+func (e *SelfTestError) Unwrap() error {
+	return e.Err
+}
+
+// SelfTest checks that the sensor is wired up and working by exercising the command set: it wakes the sensor,
+// reads its firmware version, switches to ModeQuery, takes a measurement, and then restores the sensor's prior
+// reporting mode and sleep/work state. The restore is attempted even if an earlier step fails. It returns a
+// *SelfTestError naming the first step that failed.
+//
+// The measurement is taken straight after waking, so it may not be accurate, but it shows that the sensor
+// returns data.
+func (d *Dev) SelfTest() error {
+	return d.SelfTestContext(context.Background())
+}
+
+// SelfTestContext is like SelfTest but stops waiting for responses if ctx is done. The restore steps don't use
+// ctx, so that the sensor is restored even if SelfTestContext was interrupted.
+func (d *Dev) SelfTestContext(ctx context.Context) (err error) {
+	fail := func(step string, stepErr error) {
+		if err == nil && stepErr != nil {
+			err = &SelfTestError{Step: step, Err: stepErr}
+		}
+	}
+
+	working, stateErr := d.GetSleepWorkStateContext(ctx)
+	if stateErr != nil {
+		fail("get sleep/work state", stateErr)
+		return err
+	}
+
+	fail("wake", d.WakeContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if !working {
+			fail("restore sleep", d.SleepContext(context.Background()))
+		}
+	}()
+
+	_, fwErr := d.GetFirmwareVersionContext(ctx)
+	fail("read firmware version", fwErr)
+	if err != nil {
+		return err
+	}
+
+	mode, modeErr := d.GetModeContext(ctx)
+	fail("get reporting mode", modeErr)
+	if err != nil {
+		return err
+	}
+
+	fail("set query mode", d.SetModeContext(ctx, ModeQuery))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if mode != ModeQuery {
+			fail("restore reporting mode", d.SetModeContext(context.Background(), mode))
+		}
+	}()
+
+	_, senseErr := d.SenseContext(ctx)
+	fail("sample", senseErr)
+	return err
+}
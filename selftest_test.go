@@ -0,0 +1,95 @@
+package sds011
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// frameSummary describes each written command frame by its command, set/query flag, and value.
+func frameSummary(written [][]byte) [][3]byte {
+	var s [][3]byte
+	for _, w := range written {
+		s = append(s, [3]byte{w[2], w[3], w[4]})
+	}
+	return s
+}
+
+func TestSelfTest(t *testing.T) {
+	// The echo responder reports the sensor as asleep and in ModeActive.
+	c := &fakeConn{respond: echo(queryResponse(40, 180))}
+	d := newFakeDev(c)
+
+	if err := d.SelfTest(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := [][3]byte{
+		{byte(sleepWorkCommand), 0, 0},
+		{byte(sleepWorkCommand), 1, 1},
+		{byte(firmwareVersionCommand), 0, 0},
+		{byte(modeCommand), 0, 0},
+		{byte(modeCommand), 1, byte(ModeQuery)},
+		{byte(queryCommand), 0, 0},
+		{byte(modeCommand), 1, byte(ModeActive)},
+		{byte(sleepWorkCommand), 1, 0},
+	}
+	if diff := cmp.Diff(want, frameSummary(c.written)); diff != "" {
+		t.Errorf("Unexpected commands (-want +got):\n%s", diff)
+	}
+}
+
+func TestSelfTestFailure(t *testing.T) {
+	// The sensor doesn't answer queries.
+	c := &fakeConn{respond: echo(nil)}
+	d := newFakeDev(c)
+
+	err := d.SelfTest()
+	var stErr *SelfTestError
+	if !errors.As(err, &stErr) {
+		t.Fatalf("got error %v, want a *SelfTestError", err)
+	}
+	if stErr.Step != "sample" {
+		t.Errorf("got step %q, want %q", stErr.Step, "sample")
+	}
+	if !errors.Is(err, ErrTimeout) {
+		t.Errorf("got error %v, want it to wrap %v", err, ErrTimeout)
+	}
+
+	// The prior mode and sleep state are restored despite the failure.
+	got := frameSummary(c.written[len(c.written)-2:])
+	want := [][3]byte{
+		{byte(modeCommand), 1, byte(ModeActive)},
+		{byte(sleepWorkCommand), 1, 0},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Unexpected final commands (-want +got):\n%s", diff)
+	}
+}
+
+func TestSelfTestCanceledDuringRestore(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// ctx is done once the self-test starts restoring the reporting mode. Like the real sensor, the fake takes a
+	// moment to respond to each command.
+	respond := echo(queryResponse(40, 180))
+	c := &fakeConn{}
+	c.respond = func(written []byte) []byte {
+		if command(written[2]) == modeCommand && written[3] == 1 && Mode(written[4]) == ModeActive {
+			cancel()
+		}
+		c.emptyReads = 1
+		return respond(written)
+	}
+	d := newFakeDev(c)
+
+	if err := d.SelfTestContext(ctx); err != nil {
+		t.Errorf("got error %v, want the restore to succeed regardless of ctx", err)
+	}
+	if ctx.Err() == nil {
+		t.Error("ctx wasn't canceled")
+	}
+}
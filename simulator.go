@@ -0,0 +1,253 @@
+package sds011
+
+import (
+	"encoding/binary"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// simPollInterval is the longest a read from a simulator waits for data, standing in for the serial port's read
+// timeout.
+var simPollInterval = 10 * time.Millisecond
+
+// simConfig is the model a simulator generates measurements from.
+type simConfig struct {
+	pm25, pm10 float32
+	diurnal    float64
+	peakHour   float64
+	noise      float64
+	interval   time.Duration
+	deviceID   uint16
+	seed       int64
+	now        func() time.Time
+}
+
+// SimOption configures a simulator created by NewSimulator.
+type SimOption func(*simConfig)
+
+// WithSimBase sets the mean PM2.5 and PM10 concentrations, in μg/m³. The defaults are 10 and 20.
+func WithSimBase(pm25, pm10 float32) SimOption {
+	return func(c *simConfig) {
+		c.pm25 = pm25
+		c.pm10 = pm10
+	}
+}
+
+// WithSimDiurnal sets the amplitude of the daily variation, as a fraction of the mean, and the local hour at which
+// concentrations peak. Concentrations follow a sine wave over the day, so an amplitude of 0.3 gives 30% above the
+// mean at the peak and 30% below it twelve hours later. The defaults are 0.3 and 8, for a morning rush hour.
+func WithSimDiurnal(amplitude float64, peakHour float64) SimOption {
+	return func(c *simConfig) {
+		c.diurnal = amplitude
+		c.peakHour = peakHour
+	}
+}
+
+// WithSimNoise sets the standard deviation, in μg/m³, of the random noise added to each measurement. The default
+// is 1.
+func WithSimNoise(stddev float64) SimOption {
+	return func(c *simConfig) {
+		c.noise = stddev
+	}
+}
+
+// WithSimInterval sets how often the simulator sends a measurement in ModeActive with a working period of 0. The
+// real sensor sends one every second, which is the default; a shorter interval speeds up tests.
+func WithSimInterval(t time.Duration) SimOption {
+	return func(c *simConfig) {
+		c.interval = t
+	}
+}
+
+// WithSimDeviceID sets the simulated sensor's device ID. The default is 0xa160.
+func WithSimDeviceID(id uint16) SimOption {
+	return func(c *simConfig) {
+		c.deviceID = id
+	}
+}
+
+// WithSimSeed seeds the noise so that a simulator's measurements are reproducible. By default the seed is based on
+// the current time.
+func WithSimSeed(seed int64) SimOption {
+	return func(c *simConfig) {
+		c.seed = seed
+	}
+}
+
+// NewSimulator returns a Dev that talks to a simulated sensor rather than a real one, which is useful for
+// developing and demonstrating programs without hardware and for integration tests. The simulated sensor answers
+// every command the way the real one does, starting awake in ModeActive with a working period of 0, and ignoring
+// all but sleep/work commands while asleep. Its measurements are generated from a model of a mean concentration,
+// a daily variation, and random noise, configured with SimOptions.
+func NewSimulator(opts ...SimOption) *Dev {
+	c := simConfig{
+		pm25:     10,
+		pm10:     20,
+		diurnal:  0.3,
+		peakHour: 8,
+		noise:    1,
+		interval: time.Second,
+		deviceID: 0xa160,
+		seed:     time.Now().UnixNano(),
+		now:      time.Now,
+	}
+	for _, opt := range opts {
+		opt(&c)
+	}
+
+	return NewWithConn(newSimConn(c))
+}
+
+// simConn is a connection to a simulated sensor. Writes are parsed as command frames and answered by queueing
+// responses to be read, and measurements are queued on schedule in ModeActive.
+type simConn struct {
+	cfg  simConfig
+	rand *rand.Rand
+
+	mu         sync.Mutex
+	buf        []byte
+	id         uint16
+	mode       Mode
+	awake      bool
+	period     byte
+	nextReport time.Time
+}
+
+func newSimConn(c simConfig) *simConn {
+	return &simConn{
+		cfg:   c,
+		rand:  rand.New(rand.NewSource(c.seed)),
+		id:    c.deviceID,
+		mode:  ModeActive,
+		awake: true,
+	}
+}
+
+// Read returns queued responses and any measurements that are due. Like a serial port, it returns (0, nil) if no
+// data arrives within a short time.
+func (c *simConn) Read(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.buf) == 0 {
+		wait := simPollInterval
+		if c.mode == ModeActive && c.awake {
+			if until := time.Until(c.nextReport); until < wait {
+				wait = until
+			}
+		}
+		c.mu.Unlock()
+		time.Sleep(wait)
+		c.mu.Lock()
+	}
+
+	if c.mode == ModeActive && c.awake && !time.Now().Before(c.nextReport) {
+		c.buf = append(c.buf, c.measurement()...)
+		c.nextReport = time.Now().Add(c.reportInterval())
+	}
+
+	n := copy(p, c.buf)
+	c.buf = c.buf[n:]
+	return n, nil
+}
+
+// reportInterval is the time between measurements sent in ModeActive. The caller must hold c.mu.
+func (c *simConn) reportInterval() time.Duration {
+	if c.period == 0 {
+		return c.cfg.interval
+	}
+	return time.Duration(c.period) * time.Minute
+}
+
+// Write handles a command frame. Frames that are malformed or addressed to another sensor are ignored, as the
+// sensor does.
+func (c *simConn) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(p) != commandLength || p[0] != head || p[1] != 0xb4 || p[commandLength-1] != tail ||
+		Checksum(p[2:commandLength-2]) != p[commandLength-2] {
+		return len(p), nil
+	}
+	if id := binary.BigEndian.Uint16(p[commandLength-4:]); id != BroadcastID && id != c.id {
+		return len(p), nil
+	}
+
+	cmd, set, value := command(p[2]), p[3] == 1, p[4]
+	if !c.awake && cmd != sleepWorkCommand {
+		return len(p), nil
+	}
+
+	switch cmd {
+	case modeCommand:
+		if set {
+			c.mode = Mode(value)
+			c.nextReport = time.Now()
+		}
+		c.respond(cmd, p[3], byte(c.mode), 0)
+	case queryCommand:
+		c.buf = append(c.buf, c.measurement()...)
+	case deviceIDCommand:
+		c.id = binary.BigEndian.Uint16(p[13:15])
+		c.respond(cmd, 0, 0, 0)
+	case sleepWorkCommand:
+		if set {
+			c.awake = value == 1
+			c.nextReport = time.Now()
+		}
+		var working byte
+		if c.awake {
+			working = 1
+		}
+		c.respond(cmd, p[3], working, 0)
+	case workingPeriodCommand:
+		if set {
+			c.period = value
+		}
+		c.respond(cmd, p[3], c.period, 0)
+	case firmwareVersionCommand:
+		c.respond(cmd, 18, 11, 16)
+	}
+	return len(p), nil
+}
+
+// respond queues a response to a command. The caller must hold c.mu.
+func (c *simConn) respond(cmd command, data ...byte) {
+	b := []byte{head, byte(cmdTypeGeneral), byte(cmd), data[0], data[1], data[2], byte(c.id >> 8), byte(c.id), 0,
+		tail}
+	b[8] = Checksum(b[2:8])
+	c.buf = append(c.buf, b...)
+}
+
+// measurement returns a measurement packet generated from the model. The caller must hold c.mu.
+func (c *simConn) measurement() []byte {
+	t := c.cfg.now()
+	hour := float64(t.Hour()) + float64(t.Minute())/60
+	level := 1 + c.cfg.diurnal*math.Cos(2*math.Pi*(hour-c.cfg.peakHour)/24)
+
+	sample := func(base float32) uint16 {
+		v := float64(base)*level + c.rand.NormFloat64()*c.cfg.noise
+		return uint16(math.Round(math.Max(0, math.Min(v, float64(MaxConcentration))) * 10))
+	}
+	pm25, pm10 := sample(c.cfg.pm25), sample(c.cfg.pm10)
+
+	b := []byte{head, byte(cmdTypeQuery), byte(pm25), byte(pm25 >> 8), byte(pm10), byte(pm10 >> 8),
+		byte(c.id >> 8), byte(c.id), 0, tail}
+	b[8] = Checksum(b[2:8])
+	return b
+}
+
+// ResetInputBuffer discards queued data, like flushing a serial port.
+func (c *simConn) ResetInputBuffer() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.buf = c.buf[:0]
+	return nil
+}
+
+func (c *simConn) Close() error {
+	return nil
+}
@@ -0,0 +1,112 @@
+package sds011
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func newTestSimulator(opts ...SimOption) *Dev {
+	opts = append([]SimOption{WithSimSeed(1), WithSimInterval(10 * time.Millisecond)}, opts...)
+	return NewSimulator(opts...)
+}
+
+func TestSimulatorCommands(t *testing.T) {
+	d := newTestSimulator(WithSimBase(12.3, 45.6), WithSimDiurnal(0, 0), WithSimNoise(0))
+	if err := d.SetReadTimeout(100 * time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.SetMode(ModeQuery); err != nil {
+		t.Fatal(err)
+	}
+	if mode, err := d.GetMode(); err != nil || mode != ModeQuery {
+		t.Errorf("GetMode() = %v, %v, want %v, nil", mode, err, ModeQuery)
+	}
+
+	got, err := d.Sense()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Measurement{PM25: 12.3, PM10: 45.6, DeviceID: 0xa160}
+	if diff := cmp.Diff(want, got, cmpFloats, ignoreTime); diff != "" {
+		t.Errorf("Unexpected measurement (-want +got):\n%s", diff)
+	}
+
+	if err := d.SetDeviceID(0x1234); err != nil {
+		t.Fatal(err)
+	}
+	if id, err := d.GetDeviceID(); err != nil || id != 0x1234 {
+		t.Errorf("GetDeviceID() = 0x%04x, %v, want 0x1234, nil", id, err)
+	}
+
+	if err := d.SetPeriod(5); err != nil {
+		t.Fatal(err)
+	}
+	if period, err := d.GetWorkingPeriod(); err != nil || period != 5 {
+		t.Errorf("GetWorkingPeriod() = %v, %v, want 5, nil", period, err)
+	}
+
+	// Asleep, the sensor only answers sleep/work commands.
+	if err := d.Sleep(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Sense(); err != ErrTimeout {
+		t.Errorf("got error %v from Sense while asleep, want %v", err, ErrTimeout)
+	}
+	if err := d.Wake(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.SelfTest(); err != nil {
+		t.Errorf("SelfTest() = %v, want nil", err)
+	}
+}
+
+func TestSimulatorListen(t *testing.T) {
+	d := newTestSimulator(WithSimBase(50, 100), WithSimNoise(2))
+
+	var got []Measurement
+	err := d.ListenE(func(m Measurement) error {
+		got = append(got, m)
+		if len(got) == 5 {
+			d.Stop()
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The daily variation is at most 30% and the noise is small, so readings stay near the mean.
+	for _, m := range got {
+		if m.PM25 < 25 || m.PM25 > 75 || m.PM10 < 50 || m.PM10 > 150 {
+			t.Errorf("got implausible measurement %v", m)
+		}
+	}
+}
+
+func TestSimulatorDiurnal(t *testing.T) {
+	c := newSimConn(simConfig{pm25: 10, pm10: 20, diurnal: 0.5, peakHour: 8})
+
+	at := func(hour int) Measurement {
+		c.cfg.now = func() time.Time {
+			return time.Date(2021, 3, 4, hour, 0, 0, 0, time.Local)
+		}
+		m, err := DecodePacket(c.measurement())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+
+	want := []Measurement{
+		{PM25: 15, PM10: 30},
+		{PM25: 5, PM10: 10},
+	}
+	got := []Measurement{at(8), at(20)}
+	if diff := cmp.Diff(want, got, cmpFloats); diff != "" {
+		t.Errorf("Unexpected measurements at peak and trough (-want +got):\n%s", diff)
+	}
+}
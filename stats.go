@@ -0,0 +1,258 @@
+package sds011
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Stats summarizes a series of measurements.
+type Stats struct {
+	Count int
+	PM25  PollutantStats
+	PM10  PollutantStats
+}
+
+// PollutantStats summarizes the concentrations of one pollutant, in μg/m³.
+type PollutantStats struct {
+	Min  float32
+	Max  float32
+	Mean float32
+}
+
+// Accumulator keeps running statistics over measurements without storing them. It's safe for concurrent use. The
+// zero value is ready to use.
+type Accumulator struct {
+	mu   sync.Mutex
+	pm25 pollutantAccumulator
+	pm10 pollutantAccumulator
+	n    int
+}
+
+type pollutantAccumulator struct {
+	min, max float32
+	sum      float64
+}
+
+func (a *pollutantAccumulator) add(v float32, first bool) {
+	if first || v < a.min {
+		a.min = v
+	}
+	if first || v > a.max {
+		a.max = v
+	}
+	a.sum += float64(v)
+}
+
+func (a pollutantAccumulator) stats(n int) PollutantStats {
+	return PollutantStats{
+		Min:  a.min,
+		Max:  a.max,
+		Mean: float32(a.sum / float64(n)),
+	}
+}
+
+// Add adds m to the statistics.
+func (a *Accumulator) Add(m Measurement) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.pm25.add(m.PM25, a.n == 0)
+	a.pm10.add(m.PM10, a.n == 0)
+	a.n++
+}
+
+// Summary returns the statistics of the measurements added since the Accumulator was created or reset. If none
+// have been added then it returns the zero Stats.
+func (a *Accumulator) Summary() Stats {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.n == 0 {
+		return Stats{}
+	}
+	return Stats{
+		Count: a.n,
+		PM25:  a.pm25.stats(a.n),
+		PM10:  a.pm10.stats(a.n),
+	}
+}
+
+// Reset discards all measurements added so far.
+func (a *Accumulator) Reset() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.pm25 = pollutantAccumulator{}
+	a.pm10 = pollutantAccumulator{}
+	a.n = 0
+}
+
+// DefaultRollingWindow is the window used by a RollingAverage whose window isn't set. It's the averaging period
+// that the US EPA defines the PM AQI on.
+const DefaultRollingWindow = 24 * time.Hour
+
+// RollingAverage averages the measurements taken within a sliding time window, such as the 24 hours that AQI
+// should be computed over. Samples older than the window are evicted as new ones are added, so memory use is
+// proportional to the number of samples in one window. It's safe for concurrent use. The zero value is ready to
+// use and has a window of DefaultRollingWindow.
+type RollingAverage struct {
+	mu      sync.Mutex
+	window  time.Duration
+	samples []timedMeasurement
+	start   int
+}
+
+type timedMeasurement struct {
+	m Measurement
+	t time.Time
+}
+
+// NewRollingAverage returns a RollingAverage over the given window. If window isn't positive then
+// DefaultRollingWindow is used.
+func NewRollingAverage(window time.Duration) *RollingAverage {
+	return &RollingAverage{window: window}
+}
+
+// Add adds m, taken at time t, and evicts samples that are older than the window relative to t. Samples should be
+// added in time order; a sample that's already outside the window when it's added is dropped.
+func (r *RollingAverage) Add(m Measurement, t time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	window := r.window
+	if window <= 0 {
+		window = DefaultRollingWindow
+	}
+
+	cutoff := t.Add(-window)
+	for r.start < len(r.samples) && !r.samples[r.start].t.After(cutoff) {
+		r.samples[r.start] = timedMeasurement{}
+		r.start++
+	}
+
+	// Reclaim the evicted prefix once it's at least half the slice so that the backing array doesn't grow without
+	// bound.
+	if r.start > 0 && r.start >= len(r.samples)/2 {
+		n := copy(r.samples, r.samples[r.start:])
+		r.samples = r.samples[:n]
+		r.start = 0
+	}
+
+	if len(r.samples) > r.start && !t.After(r.samples[len(r.samples)-1].t.Add(-window)) {
+		return
+	}
+	r.samples = append(r.samples, timedMeasurement{m: m, t: t})
+}
+
+// Average returns the mean of the samples in the window, with the Time and DeviceID of the newest sample. Pass it
+// to AQI for an index computed over the window rather than from a single reading. If there are no samples then it
+// returns the zero Measurement.
+func (r *RollingAverage) Average() Measurement {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	live := r.samples[r.start:]
+	if len(live) == 0 {
+		return Measurement{}
+	}
+
+	var pm25, pm10 float64
+	for _, s := range live {
+		pm25 += float64(s.m.PM25)
+		pm10 += float64(s.m.PM10)
+	}
+	newest := live[len(live)-1]
+	return Measurement{
+		PM25:     float32(pm25 / float64(len(live))),
+		PM10:     float32(pm10 / float64(len(live))),
+		DeviceID: newest.m.DeviceID,
+		Time:     newest.t,
+	}
+}
+
+// Len returns the number of samples in the window.
+func (r *RollingAverage) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return len(r.samples) - r.start
+}
+
+// Histogram tallies measurements into bins by concentration, separately for PM2.5 and PM10, to show how readings
+// are distributed. It doesn't depend on a Dev, so it can be fed replayed or stored measurements too. It's safe for
+// concurrent use.
+type Histogram struct {
+	mu    sync.Mutex
+	edges []float32
+	pm25  []int
+	pm10  []int
+}
+
+// HistogramCounts is a snapshot of a Histogram. PM25 and PM10 each have len(Edges)+1 counts: the first is of
+// concentrations below Edges[0], count i is of concentrations in [Edges[i-1], Edges[i]), and the last is of
+// concentrations at or above the last edge.
+type HistogramCounts struct {
+	Edges []float32
+	PM25  []int
+	PM10  []int
+}
+
+// NewHistogram returns a Histogram with bins divided at the given edges, in μg/m³. It panics if there are no edges
+// or they aren't strictly increasing.
+func NewHistogram(edges ...float32) *Histogram {
+	if len(edges) == 0 {
+		panic("sds011: histogram needs at least one bin edge")
+	}
+	for i := 1; i < len(edges); i++ {
+		if edges[i] <= edges[i-1] {
+			panic(fmt.Sprintf("sds011: histogram bin edges must be strictly increasing, got %v", edges))
+		}
+	}
+
+	return &Histogram{
+		edges: append([]float32(nil), edges...),
+		pm25:  make([]int, len(edges)+1),
+		pm10:  make([]int, len(edges)+1),
+	}
+}
+
+// bin returns the index of the bin that v falls in.
+func (h *Histogram) bin(v float32) int {
+	return sort.Search(len(h.edges), func(i int) bool {
+		return h.edges[i] > v
+	})
+}
+
+// Add tallies m's concentrations.
+func (h *Histogram) Add(m Measurement) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.pm25[h.bin(m.PM25)]++
+	h.pm10[h.bin(m.PM10)]++
+}
+
+// Counts returns a copy of the bin edges and counts.
+func (h *Histogram) Counts() HistogramCounts {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return HistogramCounts{
+		Edges: append([]float32(nil), h.edges...),
+		PM25:  append([]int(nil), h.pm25...),
+		PM10:  append([]int(nil), h.pm10...),
+	}
+}
+
+// Reset sets all counts to zero.
+func (h *Histogram) Reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i := range h.pm25 {
+		h.pm25[i] = 0
+		h.pm10[i] = 0
+	}
+}
@@ -0,0 +1,144 @@
+package sds011
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestAccumulator(t *testing.T) {
+	var a Accumulator
+
+	if diff := cmp.Diff(Stats{}, a.Summary()); diff != "" {
+		t.Errorf("Unexpected empty summary (-want +got):\n%s", diff)
+	}
+
+	for _, m := range []Measurement{
+		{PM25: 4, PM10: 10},
+		{PM25: 1, PM10: 30},
+		{PM25: 7, PM10: 20},
+	} {
+		a.Add(m)
+	}
+
+	want := Stats{
+		Count: 3,
+		PM25:  PollutantStats{Min: 1, Max: 7, Mean: 4},
+		PM10:  PollutantStats{Min: 10, Max: 30, Mean: 20},
+	}
+	if diff := cmp.Diff(want, a.Summary(), cmpFloats); diff != "" {
+		t.Errorf("Unexpected summary (-want +got):\n%s", diff)
+	}
+
+	a.Reset()
+	a.Add(Measurement{PM25: 50, PM10: 60})
+	want = Stats{
+		Count: 1,
+		PM25:  PollutantStats{Min: 50, Max: 50, Mean: 50},
+		PM10:  PollutantStats{Min: 60, Max: 60, Mean: 60},
+	}
+	if diff := cmp.Diff(want, a.Summary(), cmpFloats); diff != "" {
+		t.Errorf("Unexpected summary after Reset (-want +got):\n%s", diff)
+	}
+}
+
+func TestAccumulatorAddAllocs(t *testing.T) {
+	var a Accumulator
+	m := Measurement{PM25: 4, PM10: 10}
+	if n := testing.AllocsPerRun(100, func() { a.Add(m) }); n != 0 {
+		t.Errorf("Add made %v allocations, want 0", n)
+	}
+}
+
+func TestRollingAverage(t *testing.T) {
+	r := NewRollingAverage(time.Hour)
+	if diff := cmp.Diff(Measurement{}, r.Average(), ignoreRaw); diff != "" {
+		t.Errorf("Unexpected empty average (-want +got):\n%s", diff)
+	}
+
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	r.Add(Measurement{PM25: 100, PM10: 200}, start)
+	r.Add(Measurement{PM25: 10, PM10: 20}, start.Add(30*time.Minute))
+	r.Add(Measurement{PM25: 20, PM10: 40, DeviceID: 0xa160}, start.Add(time.Hour))
+
+	// The first sample is exactly one window old, so it's been evicted.
+	want := Measurement{PM25: 15, PM10: 30, DeviceID: 0xa160, Time: start.Add(time.Hour)}
+	if diff := cmp.Diff(want, r.Average(), cmpFloats); diff != "" {
+		t.Errorf("Unexpected average (-want +got):\n%s", diff)
+	}
+	if got, want := r.Len(), 2; got != want {
+		t.Errorf("got %v samples, want %v", got, want)
+	}
+
+	// A sample that's older than the window is dropped.
+	r.Add(Measurement{PM25: 1000}, start)
+	if got, want := r.Len(), 2; got != want {
+		t.Errorf("got %v samples after adding a stale one, want %v", got, want)
+	}
+}
+
+func TestRollingAverageBounded(t *testing.T) {
+	var r RollingAverage
+
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 10000; i++ {
+		r.Add(Measurement{PM25: 1, PM10: 2}, start.Add(time.Duration(i)*time.Hour))
+	}
+
+	// With the default 24-hour window and hourly samples, only a day's worth is kept.
+	if got, want := r.Len(), 24; got != want {
+		t.Errorf("got %v samples, want %v", got, want)
+	}
+	if c := cap(r.samples); c > 100 {
+		t.Errorf("got capacity %v, want it bounded by the window", c)
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	h := NewHistogram(12, 35.5, 55.5)
+
+	for _, m := range []Measurement{
+		{PM25: 0, PM10: 20},
+		{PM25: 11.9, PM10: 40},
+		{PM25: 12, PM10: 60},
+		{PM25: 35.4, PM10: 100},
+		{PM25: 55.5, PM10: 999.9},
+	} {
+		h.Add(m)
+	}
+
+	want := HistogramCounts{
+		Edges: []float32{12, 35.5, 55.5},
+		PM25:  []int{2, 2, 0, 1},
+		PM10:  []int{0, 1, 1, 3},
+	}
+	got := h.Counts()
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Unexpected counts (-want +got):\n%s", diff)
+	}
+
+	// The snapshot doesn't change as more are added.
+	h.Add(Measurement{})
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Snapshot changed (-want +got):\n%s", diff)
+	}
+
+	h.Reset()
+	if got := h.Counts(); got.PM25[0] != 0 || got.PM10[0] != 0 {
+		t.Errorf("got counts %v after Reset, want zeros", got)
+	}
+}
+
+func TestNewHistogramPanics(t *testing.T) {
+	for _, edges := range [][]float32{nil, {10, 10}, {20, 10}} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("NewHistogram(%v) didn't panic", edges)
+				}
+			}()
+			NewHistogram(edges...)
+		}()
+	}
+}
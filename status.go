@@ -0,0 +1,236 @@
+package sds011
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// DeviceStatus is a snapshot of a sensor's configuration.
+type DeviceStatus struct {
+	Mode   Mode
+	Period int
+
+	// Sleeping reports whether the sensor is asleep. A sleeping sensor ignores every other query, so if it's
+	// true then the other fields aren't filled in.
+	Sleeping bool
+
+	DeviceID uint16
+	Firmware FirmwareVersion
+}
+
+// GetStatus queries the sensor for its sleep/work state and, if it's awake, its reporting mode, working period,
+// device ID, and firmware version. It stops at the first query that fails and returns an error naming it.
+func (d *Dev) GetStatus() (DeviceStatus, error) {
+	return d.GetStatusContext(context.Background())
+}
+
+// GetStatusContext is like GetStatus but stops waiting for responses if ctx is done.
+func (d *Dev) GetStatusContext(ctx context.Context) (DeviceStatus, error) {
+	var s DeviceStatus
+	var err error
+
+	// The sensor answers the sleep/work state query even while asleep, so ask that first.
+	working, err := d.GetSleepWorkStateContext(ctx)
+	if err != nil {
+		return DeviceStatus{}, statusError("sleep/work state", err)
+	}
+	if !working {
+		return DeviceStatus{Sleeping: true}, nil
+	}
+
+	if s.Mode, s.Period, err = d.GetModeAndPeriodContext(ctx); err != nil {
+		return DeviceStatus{}, err
+	}
+
+	// The firmware version response also carries the device ID.
+	b, err := d.command(ctx, firmwareVersionCommand)
+	if err != nil {
+		return DeviceStatus{}, statusError("firmware version", err)
+	}
+	s.DeviceID = packetID(b)
+	s.Firmware = firmwareVersion(b)
+
+	return s, nil
+}
+
+// GetModeAndPeriod queries the sensor for its reporting mode and working period, which together determine when it
+// reports, so they're often checked together at startup. The protocol has no single command for both. Pipelining
+// the two queries isn't reliable, since the sensor may miss a command sent before it has answered the previous
+// one, so they're sent one after the other. If either fails then the error names it.
+func (d *Dev) GetModeAndPeriod() (Mode, int, error) {
+	return d.GetModeAndPeriodContext(context.Background())
+}
+
+// GetModeAndPeriodContext is like GetModeAndPeriod but stops waiting for responses if ctx is done.
+func (d *Dev) GetModeAndPeriodContext(ctx context.Context) (Mode, int, error) {
+	mode, err := d.GetModeContext(ctx)
+	if err != nil {
+		return 0, 0, statusError("reporting mode", err)
+	}
+	period, err := d.GetWorkingPeriodContext(ctx)
+	if err != nil {
+		return 0, 0, statusError("working period", err)
+	}
+	return mode, period, nil
+}
+
+func statusError(step string, err error) error {
+	return fmt.Errorf("sds011: getting %s: %w", step, err)
+}
+
+// Reset returns the sensor to its default configuration: ModeActive, continuous operation (a working period of
+// 0), and awake. It stops at the first command that fails and returns an error naming it.
+func (d *Dev) Reset() error {
+	return d.ResetContext(context.Background())
+}
+
+// ResetContext is like Reset but stops waiting for responses if ctx is done.
+func (d *Dev) ResetContext(ctx context.Context) error {
+	// A sleeping sensor ignores the other commands, so wake it first.
+	if err := d.WakeContext(ctx); err != nil {
+		return fmt.Errorf("sds011: reset: waking: %w", err)
+	}
+	if err := d.SetModeContext(ctx, ModeActive); err != nil {
+		return fmt.Errorf("sds011: reset: setting reporting mode: %w", err)
+	}
+	if err := d.SetPeriodContext(ctx, 0); err != nil {
+		return fmt.Errorf("sds011: reset: setting working period: %w", err)
+	}
+	return nil
+}
+
+// Config is a sensor configuration to apply with Apply.
+type Config struct {
+	Mode Mode
+
+	// Period is the working period in minutes, from 0 (continuous) to 30.
+	Period int
+
+	// DeviceID is the device ID to give the sensor. If it's 0 then the ID is left unchanged.
+	DeviceID uint16
+}
+
+// ApplyError is returned by Apply when it fails to apply a field of a Config.
+type ApplyError struct {
+	// Field is the field that failed: "mode", "period", or "device ID".
+	Field string
+	Err   error
+
+	// Applied lists the fields that were changed before the failure.
+	Applied []string
+
+	// RollbackErr is the error from restoring the fields in Applied to their previous values, or nil if that
+	// succeeded.
+	RollbackErr error
+}
+
+func (e *ApplyError) Error() string {
+	s := "sds011: applying config: " + e.Field + ": " + e.Err.Error()
+	if len(e.Applied) == 0 {
+		return s
+	}
+
+	s += " (changed " + strings.Join(e.Applied, ", ")
+	if e.RollbackErr != nil {
+		return s + "; rollback failed: " + e.RollbackErr.Error() + ")"
+	}
+	return s + "; rolled back)"
+}
+
+func (e *ApplyError) Unwrap() error {
+	return e.Err
+}
+
+// Apply configures the sensor's reporting mode, working period, and device ID, in that order, as one operation.
+// Each field is set only if the sensor's current value differs, so applying the same Config again changes
+// nothing, and then read back to verify it. If a field fails then the fields already changed are restored to
+// their previous values, and Apply returns an *ApplyError describing what failed, what had been changed, and
+// whether restoring it succeeded.
+//
+// The sensor must be awake.
+func (d *Dev) Apply(cfg Config) error {
+	return d.ApplyContext(context.Background(), cfg)
+}
+
+// ApplyContext is like Apply but stops waiting for responses if ctx is done. Restoring the fields already changed
+// doesn't use ctx, so that the sensor isn't left half-configured when ctx is done.
+func (d *Dev) ApplyContext(ctx context.Context, cfg Config) error {
+	if cfg.Mode != ModeActive && cfg.Mode != ModeQuery {
+		return &ApplyError{Field: "mode", Err: fmt.Errorf("invalid mode %v", cfg.Mode)}
+	}
+	if cfg.Period < 0 || cfg.Period > 30 {
+		err := fmt.Errorf("period out of range, got %v, expected [0, 30]", cfg.Period)
+		return &ApplyError{Field: "period", Err: err}
+	}
+
+	var applied []string
+	var undo []func() error
+	fail := func(field string, err error) error {
+		e := &ApplyError{Field: field, Err: err, Applied: applied}
+		for i := len(undo) - 1; i >= 0; i-- {
+			if err := undo[i](); err != nil && e.RollbackErr == nil {
+				e.RollbackErr = err
+			}
+		}
+		return e
+	}
+
+	mode, err := d.GetModeContext(ctx)
+	if err != nil {
+		return fail("mode", err)
+	}
+	if mode != cfg.Mode {
+		if err := d.SetModeContext(ctx, cfg.Mode); err != nil {
+			return fail("mode", err)
+		}
+		applied = append(applied, "mode")
+		undo = append(undo, func() error { return d.SetModeContext(context.Background(), mode) })
+
+		if got, err := d.GetModeContext(ctx); err != nil {
+			return fail("mode", err)
+		} else if got != cfg.Mode {
+			return fail("mode", fmt.Errorf("read back %v, expected %v", got, cfg.Mode))
+		}
+	}
+
+	period, err := d.GetWorkingPeriodContext(ctx)
+	if err != nil {
+		return fail("period", err)
+	}
+	if period != cfg.Period {
+		if err := d.SetPeriodContext(ctx, cfg.Period); err != nil {
+			return fail("period", err)
+		}
+		applied = append(applied, "period")
+		undo = append(undo, func() error { return d.SetPeriodContext(context.Background(), period) })
+
+		if got, err := d.GetWorkingPeriodContext(ctx); err != nil {
+			return fail("period", err)
+		} else if got != cfg.Period {
+			return fail("period", fmt.Errorf("read back %v, expected %v", got, cfg.Period))
+		}
+	}
+
+	if cfg.DeviceID != 0 {
+		id, err := d.GetDeviceIDContext(ctx)
+		if err != nil {
+			return fail("device ID", err)
+		}
+		if id != cfg.DeviceID {
+			if err := d.SetDeviceIDContext(ctx, cfg.DeviceID); err != nil {
+				return fail("device ID", err)
+			}
+			applied = append(applied, "device ID")
+			undo = append(undo, func() error { return d.SetDeviceIDContext(context.Background(), id) })
+
+			if got, err := d.GetDeviceIDContext(ctx); err != nil {
+				return fail("device ID", err)
+			} else if got != cfg.DeviceID {
+				return fail("device ID", fmt.Errorf("read back 0x%04x, expected 0x%04x", got, cfg.DeviceID))
+			}
+		}
+	}
+
+	return nil
+}
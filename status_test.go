@@ -0,0 +1,350 @@
+package sds011
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestGetStatus(t *testing.T) {
+	c := &fakeConn{
+		replies: [][]byte{
+			generalResponse(sleepWorkCommand, 0x00, 0x01),
+			generalResponse(modeCommand, 0x00, 0x01),
+			generalResponse(workingPeriodCommand, 0x00, 0x05),
+			generalResponse(firmwareVersionCommand, 0x0f, 0x07, 0x0a),
+		},
+	}
+	d := newFakeDev(c)
+
+	got, err := d.GetStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := DeviceStatus{
+		Mode:     ModeQuery,
+		Period:   5,
+		DeviceID: 0xa160,
+		Firmware: FirmwareVersion{Year: 15, Month: 7, Day: 10},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Unexpected result (-want +got):\n%s", diff)
+	}
+}
+
+func TestGetStatusSleeping(t *testing.T) {
+	d := newTestSimulator()
+	if err := d.SetReadTimeout(100 * time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Sleep(); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := d.GetStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(DeviceStatus{Sleeping: true}, got); diff != "" {
+		t.Errorf("Unexpected result (-want +got):\n%s", diff)
+	}
+}
+
+func TestGetStatusStopsAtFirstError(t *testing.T) {
+	// The sensor doesn't answer the working period query.
+	c := &fakeConn{
+		replies: [][]byte{
+			generalResponse(sleepWorkCommand, 0x00, 0x01),
+			generalResponse(modeCommand, 0x00, 0x00),
+		},
+	}
+	d := newFakeDev(c)
+
+	_, err := d.GetStatus()
+	if !errors.Is(err, ErrTimeout) {
+		t.Fatalf("got error %v, want %v", err, ErrTimeout)
+	}
+	if !strings.Contains(err.Error(), "working period") {
+		t.Errorf("error %q doesn't name the failing query", err)
+	}
+	if got, want := len(c.written), 3; got != want {
+		t.Errorf("got %v commands written, want %v", got, want)
+	}
+}
+
+func TestGetModeAndPeriod(t *testing.T) {
+	d := newFakeDev(&fakeConn{
+		replies: [][]byte{
+			generalResponse(modeCommand, 0x00, 0x01),
+			generalResponse(workingPeriodCommand, 0x00, 0x05),
+		},
+	})
+
+	mode, period, err := d.GetModeAndPeriod()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode != ModeQuery || period != 5 {
+		t.Errorf("got %v, %v, want %v, 5", mode, period, ModeQuery)
+	}
+
+	// The sensor has stopped responding.
+	_, _, err = d.GetModeAndPeriod()
+	if !errors.Is(err, ErrTimeout) {
+		t.Fatalf("got error %v, want %v", err, ErrTimeout)
+	}
+	if !strings.Contains(err.Error(), "reporting mode") {
+		t.Errorf("error %q doesn't name the failing query", err)
+	}
+}
+
+func TestReset(t *testing.T) {
+	c := &fakeConn{respond: echo(nil)}
+	d := newFakeDev(c)
+
+	if err := d.Reset(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Each command is sent with its set flag and value in the first two data bytes.
+	want := [][]byte{
+		{byte(sleepWorkCommand), 0x01, 0x01},
+		{byte(modeCommand), 0x01, byte(ModeActive)},
+		{byte(workingPeriodCommand), 0x01, 0x00},
+	}
+	var got [][]byte
+	for _, w := range c.written {
+		got = append(got, w[2:5])
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Unexpected commands (-want +got):\n%s", diff)
+	}
+}
+
+func TestResetSleeping(t *testing.T) {
+	d := newTestSimulator()
+	if err := d.SetReadTimeout(100 * time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SetMode(ModeQuery); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Sleep(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	if mode, err := d.GetMode(); err != nil || mode != ModeActive {
+		t.Errorf("GetMode() = %v, %v, want %v, nil", mode, err, ModeActive)
+	}
+}
+
+func TestResetStopsAtFirstError(t *testing.T) {
+	// The sensor wakes and acknowledges the mode but not the working period.
+	c := &fakeConn{
+		replies: [][]byte{
+			generalResponse(sleepWorkCommand, 0x01, 0x01),
+			generalResponse(modeCommand, 0x01, 0x00),
+		},
+	}
+	d := newFakeDev(c)
+
+	err := d.Reset()
+	if !errors.Is(err, ErrTimeout) {
+		t.Fatalf("got error %v, want %v", err, ErrTimeout)
+	}
+	if !strings.Contains(err.Error(), "working period") {
+		t.Errorf("error %q doesn't name the failing command", err)
+	}
+	if got, want := len(c.written), 3; got != want {
+		t.Errorf("got %v commands written, want %v", got, want)
+	}
+}
+
+// dropConn is a simulated sensor that ignores one command. If after is set then the command is only ignored once
+// after has been written.
+type dropConn struct {
+	*simConn
+	drop  command
+	after command
+	seen  bool
+}
+
+func (c *dropConn) Write(p []byte) (int, error) {
+	if command(p[2]) == c.drop && (c.after == 0 || c.seen) {
+		return len(p), nil
+	}
+	if command(p[2]) == c.after {
+		c.seen = true
+	}
+	return c.simConn.Write(p)
+}
+
+func newApplyTestDev(drop command) *Dev {
+	c := &dropConn{
+		simConn: newSimConn(simConfig{interval: 10 * time.Millisecond, deviceID: 0xa160, now: time.Now}),
+		drop:    drop,
+	}
+	return NewWithConn(c, WithReadTimeout(50*time.Millisecond))
+}
+
+func TestApply(t *testing.T) {
+	d := newApplyTestDev(0)
+
+	cfg := Config{Mode: ModeQuery, Period: 5, DeviceID: 0x1234}
+	for i := 0; i < 2; i++ {
+		// Applying the same Config again succeeds without changing anything.
+		if err := d.Apply(cfg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := d.GetStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Mode != cfg.Mode || got.Period != cfg.Period || got.DeviceID != cfg.DeviceID {
+		t.Errorf("got status %+v after applying %+v", got, cfg)
+	}
+}
+
+func TestApplyRollback(t *testing.T) {
+	// The sensor doesn't respond to the device ID command.
+	d := newApplyTestDev(deviceIDCommand)
+
+	err := d.Apply(Config{Mode: ModeQuery, Period: 5, DeviceID: 0x1234})
+	var applyErr *ApplyError
+	if !errors.As(err, &applyErr) {
+		t.Fatalf("got error %v, want an *ApplyError", err)
+	}
+	if applyErr.Field != "device ID" {
+		t.Errorf("got field %q, want %q", applyErr.Field, "device ID")
+	}
+	if applyErr.RollbackErr != nil {
+		t.Errorf("got rollback error %v, want nil", applyErr.RollbackErr)
+	}
+	if diff := cmp.Diff([]string{"mode", "period"}, applyErr.Applied); diff != "" {
+		t.Errorf("Unexpected applied fields (-want +got):\n%s", diff)
+	}
+	if !errors.Is(err, ErrTimeout) {
+		t.Errorf("got error %v, want it to wrap %v", err, ErrTimeout)
+	}
+
+	// The mode and period were restored.
+	mode, period, err := d.GetModeAndPeriod()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode != ModeActive || period != 0 {
+		t.Errorf("got mode %v and period %v after rollback, want %v and 0", mode, period, ModeActive)
+	}
+}
+
+func TestApplyRollbackDeviceID(t *testing.T) {
+	// Once its ID is changed the sensor stops answering firmware version queries, so the new ID can't be read back.
+	c := &dropConn{
+		simConn: newSimConn(simConfig{interval: 10 * time.Millisecond, deviceID: 0xa160, now: time.Now}),
+		drop:    firmwareVersionCommand,
+		after:   deviceIDCommand,
+	}
+	d := NewWithConn(c, WithReadTimeout(50*time.Millisecond))
+	if err := d.SetMode(ModeQuery); err != nil {
+		t.Fatal(err)
+	}
+
+	err := d.Apply(Config{Mode: ModeQuery, DeviceID: 0x1234})
+	var applyErr *ApplyError
+	if !errors.As(err, &applyErr) {
+		t.Fatalf("got error %v, want an *ApplyError", err)
+	}
+	if applyErr.Field != "device ID" {
+		t.Errorf("got field %q, want %q", applyErr.Field, "device ID")
+	}
+	if applyErr.RollbackErr != nil {
+		t.Errorf("got rollback error %v, want nil", applyErr.RollbackErr)
+	}
+	if diff := cmp.Diff([]string{"device ID"}, applyErr.Applied); diff != "" {
+		t.Errorf("Unexpected applied fields (-want +got):\n%s", diff)
+	}
+
+	// The ID was restored.
+	c.mu.Lock()
+	id := c.id
+	c.mu.Unlock()
+	if id != 0xa160 {
+		t.Errorf("got device ID 0x%04x after rollback, want 0xa160", id)
+	}
+}
+
+// cancelConn is a simulated sensor that takes a moment to respond to each command, like the real one, and calls
+// cancel when the command on is written.
+type cancelConn struct {
+	*simConn
+	on      command
+	cancel  context.CancelFunc
+	pending bool
+}
+
+func (c *cancelConn) Write(p []byte) (int, error) {
+	if command(p[2]) == c.on {
+		c.cancel()
+	}
+	c.pending = true
+	return c.simConn.Write(p)
+}
+
+func (c *cancelConn) Read(p []byte) (int, error) {
+	if c.pending {
+		c.pending = false
+		time.Sleep(time.Millisecond)
+		return 0, nil
+	}
+	return c.simConn.Read(p)
+}
+
+func TestApplyCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// ctx is done once the mode has been changed, when Apply queries the working period.
+	c := &cancelConn{
+		simConn: newSimConn(simConfig{interval: 10 * time.Millisecond, deviceID: 0xa160, now: time.Now}),
+		on:      workingPeriodCommand,
+		cancel:  cancel,
+	}
+	d := NewWithConn(c, WithReadTimeout(50*time.Millisecond))
+
+	err := d.ApplyContext(ctx, Config{Mode: ModeQuery, Period: 5})
+	var applyErr *ApplyError
+	if !errors.As(err, &applyErr) {
+		t.Fatalf("got error %v, want an *ApplyError", err)
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("got error %v, want it to wrap %v", err, context.Canceled)
+	}
+	if applyErr.RollbackErr != nil {
+		t.Errorf("got rollback error %v, want nil", applyErr.RollbackErr)
+	}
+	if diff := cmp.Diff([]string{"mode"}, applyErr.Applied); diff != "" {
+		t.Errorf("Unexpected applied fields (-want +got):\n%s", diff)
+	}
+	if mode, err := d.GetMode(); err != nil || mode != ModeActive {
+		t.Errorf("GetMode() = %v, %v after rollback, want %v, nil", mode, err, ModeActive)
+	}
+}
+
+func TestApplyInvalid(t *testing.T) {
+	d := newApplyTestDev(0)
+
+	var applyErr *ApplyError
+	if err := d.Apply(Config{Period: 31}); !errors.As(err, &applyErr) || applyErr.Field != "period" {
+		t.Errorf("got error %v, want an *ApplyError for the period", err)
+	}
+}
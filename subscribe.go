@@ -0,0 +1,100 @@
+package sds011
+
+import (
+	"context"
+	"sync"
+)
+
+// Subscribe returns a channel that receives every measurement the sensor sends in active mode, and a function to
+// unsubscribe. The first subscriber starts a read loop in the background, which is shared by all subscribers and
+// stopped when the last one unsubscribes. The read loop counts as listening, so it can't run at the same time as
+// Listen: if a Listen loop is already running then Subscribe returns ErrAlreadyListening, and ErrClosed if the Dev
+// is closed.
+//
+// Each subscriber has its own buffer, and measurements are dropped for a subscriber whose buffer is full, so a
+// slow subscriber doesn't hold up the others. If the read loop ends for another reason, such as Stop, Close, or a
+// read error, then every subscriber's channel is closed.
+func (d *Dev) Subscribe() (<-chan Measurement, func(), error) {
+	d.subMu.Lock()
+	defer d.subMu.Unlock()
+
+	// If the last subscriber just unsubscribed then wait for its read loop to finish before starting another.
+	for len(d.subs) == 0 && d.subDone != nil {
+		done := d.subDone
+		d.subMu.Unlock()
+		<-done
+		d.subMu.Lock()
+	}
+
+	if d.subDone == nil {
+		stop, err := d.startListening()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		d.subCancel = cancel
+		d.subDone = make(chan struct{})
+		d.subs = make(map[chan Measurement]struct{})
+		go d.runSubscriptions(ctx, stop, d.subDone)
+	}
+
+	ch := make(chan Measurement, streamBufferSize)
+	d.subs[ch] = struct{}{}
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			d.unsubscribe(ch)
+		})
+	}, nil
+}
+
+func (d *Dev) unsubscribe(ch chan Measurement) {
+	d.subMu.Lock()
+	defer d.subMu.Unlock()
+
+	// The channel may already have been closed because the read loop ended.
+	if _, ok := d.subs[ch]; !ok {
+		return
+	}
+	delete(d.subs, ch)
+	close(ch)
+
+	if len(d.subs) == 0 {
+		d.subCancel()
+	}
+}
+
+// runSubscriptions is the read loop shared by subscribers, registered by startListening, which returned stop. It
+// closes done when it returns.
+func (d *Dev) runSubscriptions(ctx context.Context, stop, done chan struct{}) {
+	defer close(done)
+
+	err := d.runListen(ctx, stop, func(m Measurement) error {
+		d.subMu.Lock()
+		defer d.subMu.Unlock()
+
+		for ch := range d.subs {
+			select {
+			case ch <- m:
+			default:
+			}
+		}
+		return nil
+	})
+	if err != nil && err != ctx.Err() {
+		d.logf("subscription read loop ended: %v", err)
+	}
+
+	d.subMu.Lock()
+	defer d.subMu.Unlock()
+
+	for ch := range d.subs {
+		close(ch)
+	}
+	d.subs = nil
+	d.subCancel()
+	d.subCancel = nil
+	d.subDone = nil
+}
@@ -0,0 +1,115 @@
+package sds011
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// receive waits for a measurement on ch and reports whether the channel is still open.
+func receive(t *testing.T, ch <-chan Measurement) bool {
+	t.Helper()
+
+	select {
+	case _, ok := <-ch:
+		return ok
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for measurement")
+		return false
+	}
+}
+
+func waitNotListening(t *testing.T, d *Dev) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for d.IsListening() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the read loop to stop")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	d := NewWithConn(&repeatConn{packet: queryResponse(45, 184)})
+
+	a, unsubA, err := d.Subscribe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, unsubB, err := d.Subscribe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Both subscribers get measurements, even though neither is keeping up.
+	for i := 0; i < 3; i++ {
+		if !receive(t, a) || !receive(t, b) {
+			t.Fatal("subscription channel closed")
+		}
+	}
+
+	unsubA()
+	unsubA()
+	if !receive(t, b) {
+		t.Fatal("remaining subscription channel closed")
+	}
+
+	unsubB()
+	waitNotListening(t, d)
+
+	// Subscribing again restarts the read loop.
+	c, unsubC, err := d.Subscribe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unsubC()
+	if !receive(t, c) {
+		t.Fatal("subscription channel closed")
+	}
+}
+
+func TestSubscribeStop(t *testing.T) {
+	d := NewWithConn(&repeatConn{packet: queryResponse(45, 184)})
+
+	ch, unsub, err := d.Subscribe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unsub()
+	receive(t, ch)
+
+	// Stopping the read loop closes the channel once the buffered measurements are drained.
+	d.Stop()
+	for receive(t, ch) {
+	}
+}
+
+func TestSubscribeWhileListening(t *testing.T) {
+	d := NewWithConn(&repeatConn{packet: queryResponse(45, 184)})
+
+	received := make(chan struct{})
+	var once sync.Once
+	errc := make(chan error)
+	go func() {
+		errc <- d.Listen(func(m Measurement) {
+			once.Do(func() { close(received) })
+		})
+	}()
+	<-received
+
+	if _, _, err := d.Subscribe(); err != ErrAlreadyListening {
+		t.Errorf("got error %v from Subscribe while listening, want %v", err, ErrAlreadyListening)
+	}
+
+	d.Stop()
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+
+	d.Close()
+	if _, _, err := d.Subscribe(); err != ErrClosed {
+		t.Errorf("got error %v from Subscribe after Close, want %v", err, ErrClosed)
+	}
+}
@@ -0,0 +1,106 @@
+package sds011
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestWarmup(t *testing.T) {
+	defer func(interval time.Duration) {
+		warmupInterval = interval
+	}(warmupInterval)
+	warmupInterval = time.Millisecond
+
+	c := &fakeConn{
+		replies: [][]byte{
+			queryResponse(1000, 1000),
+			queryResponse(500, 500),
+			queryResponse(300, 300),
+			queryResponse(305, 300),
+			queryResponse(300, 300),
+			queryResponse(310, 300),
+			queryResponse(300, 300),
+			queryResponse(1000, 1000),
+		},
+	}
+	d := newFakeDev(c)
+
+	if err := d.Warmup(context.Background(), 10*time.Second, 10); err != nil {
+		t.Fatal(err)
+	}
+
+	// The last five readings were within 10% of each other, so the final reply shouldn't have been requested.
+	if got, want := len(c.written), 7; got != want {
+		t.Errorf("got %v readings, want %v", got, want)
+	}
+}
+
+func TestWarmupN(t *testing.T) {
+	defer func(interval time.Duration) {
+		warmupInterval = interval
+	}(warmupInterval)
+	warmupInterval = time.Millisecond
+
+	c := &fakeConn{
+		replies: [][]byte{
+			queryResponse(1000, 1000),
+			queryResponse(500, 500),
+			queryResponse(300, 300),
+			queryResponse(305, 300),
+			queryResponse(300, 300),
+			queryResponse(1000, 1000),
+		},
+	}
+	d := newFakeDev(c)
+
+	// A threshold of 0 means DefaultWarmupStabilityPct.
+	if err := d.WarmupN(context.Background(), 10*time.Second, 0, 3); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := len(c.written), 5; got != want {
+		t.Errorf("got %v readings, want %v", got, want)
+	}
+}
+
+func TestWarmupLimit(t *testing.T) {
+	defer func(interval time.Duration) {
+		warmupInterval = interval
+	}(warmupInterval)
+	warmupInterval = 10 * time.Millisecond
+
+	c := &fakeConn{}
+	for i := uint16(1); i < 100; i++ {
+		c.replies = append(c.replies, queryResponse(i*100, i*100))
+	}
+	d := newFakeDev(c)
+
+	start := time.Now()
+	if err := d.Warmup(context.Background(), 50*time.Millisecond, 10); err != ErrNotStable {
+		t.Errorf("got error %v, want %v", err, ErrNotStable)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Warmup took %v, want it to stop after its limit", elapsed)
+	}
+}
+
+func TestWithinPercent(t *testing.T) {
+	cases := []struct {
+		prev, cur, pct float32
+		want           bool
+	}{
+		{100, 105, 10, true},
+		{100, 95, 10, true},
+		{100, 111, 10, false},
+		{100, 89, 10, false},
+		{0.2, 0.25, 10, true},
+		{0.2, 0.4, 10, false},
+	}
+
+	for _, tc := range cases {
+		if got := withinPercent(tc.prev, tc.cur, tc.pct); got != tc.want {
+			t.Errorf("withinPercent(%v, %v, %v) = %v, want %v", tc.prev, tc.cur, tc.pct, got, tc.want)
+		}
+	}
+}